@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/Verce11o/yata-auth/config"
+	"github.com/Verce11o/yata-auth/internal/lib/email/rabbitmq"
+	"log"
+	"os"
+	"time"
+)
+
+// dlq inspects and replays emails parked in the dead-letter queue, and prints
+// the rabbitmqctl command that routes rejected emails to it for brokers the
+// service cannot reach through the management api.
+//
+//	dlq [-limit n] inspect
+//	dlq [-limit n] replay
+//	dlq policy
+func main() {
+	limit := flag.Int("limit", 10, "maximum number of messages to process")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: dlq [-limit n] inspect|replay|policy")
+		os.Exit(2)
+	}
+
+	cfg := config.LoadConfig()
+
+	if flag.Arg(0) == "policy" {
+		name, pattern, definition, err := rabbitmq.DeadLetterPolicy(cfg.RabbitMQ)
+		if err != nil {
+			log.Fatalf("error while building dead letter policy: %s", err)
+		}
+
+		fmt.Printf("rabbitmqctl set_policy --apply-to queues %s '%s' '%s'\n", name, pattern, definition)
+		return
+	}
+
+	conn, err := rabbitmq.NewAmqpConnection(cfg.RabbitMQ)
+	if err != nil {
+		log.Fatalf("error while connecting to rabbitmq: %s", err)
+	}
+	defer conn.Close()
+
+	switch flag.Arg(0) {
+	case "inspect":
+		letters, err := rabbitmq.InspectDeadLetters(conn, cfg.RabbitMQ, *limit)
+		if err != nil {
+			log.Fatalf("error while inspecting dead letters: %s", err)
+		}
+
+		for _, l := range letters {
+			fmt.Printf("%s\t%s\tattempts=%d\treason=%s\n%s\n\n", l.MessageID, l.Timestamp.Format(time.RFC3339), l.Attempts, l.Reason, l.Body)
+		}
+
+		fmt.Printf("%d message(s)\n", len(letters))
+	case "replay":
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		replayed, err := rabbitmq.ReplayDeadLetters(ctx, conn, cfg.RabbitMQ, *limit)
+		if err != nil {
+			log.Fatalf("error while replaying dead letters after %d message(s): %s", replayed, err)
+		}
+
+		fmt.Printf("replayed %d message(s)\n", replayed)
+	default:
+		fmt.Fprintln(os.Stderr, "usage: dlq [-limit n] inspect|replay|policy")
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/Verce11o/yata-auth/config"
+	"github.com/Verce11o/yata-auth/internal/domain"
+	"github.com/Verce11o/yata-auth/internal/lib/emailaddr"
+	"github.com/Verce11o/yata-auth/internal/repository/postgres"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"log"
+	"os"
+	"time"
+)
+
+// backfillBatchSize is the number of users updated per transaction by -backfill.
+const backfillBatchSize = 500
+
+// email-duplicates reports users whose emails collide once canonicalized. Run
+// it before applying the lower(email) unique index, or before enabling
+// provider rules, and resolve every reported group by hand. It exits with
+// status 1 when conflicts are found. Without conflicts, -backfill stores the
+// canonical emails that registrations are checked against for the users that
+// have none yet.
+//
+//	email-duplicates [-provider-rules] [-backfill]
+func main() {
+	cfg := config.LoadConfig()
+
+	providerRules := flag.Bool("provider-rules", cfg.App.EmailNormalization.ProviderRules, "apply provider-specific dot and subaddress rules")
+	backfill := flag.Bool("backfill", false, "store the canonical emails when there are no conflicts")
+	flag.Parse()
+
+	db := postgres.NewPostgres(cfg)
+	defer db.Close()
+
+	repo := postgres.NewAuthPostgres(db, otel.Tracer("email-duplicates"))
+	normalizer := emailaddr.NewNormalizer(config.EmailNormalizationConfig{ProviderRules: *providerRules})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	users, err := repo.ListUserEmails(ctx)
+	if err != nil {
+		log.Fatalf("error while listing users: %s", err)
+	}
+
+	groups := make(map[string][]domain.User)
+	var order []string
+
+	for _, u := range users {
+		canonical, err := normalizer.Canonical(u.Email)
+		if err != nil {
+			fmt.Printf("invalid\t%s\t%s\n", u.UserID, u.Email)
+			continue
+		}
+
+		if _, ok := groups[canonical]; !ok {
+			order = append(order, canonical)
+		}
+		groups[canonical] = append(groups[canonical], u)
+	}
+
+	conflicts := 0
+	for _, canonical := range order {
+		group := groups[canonical]
+		if len(group) < 2 {
+			continue
+		}
+
+		conflicts++
+		fmt.Printf("%s\n", canonical)
+		for _, u := range group {
+			fmt.Printf("\t%s\t%s\t%s\n", u.UserID, u.Email, u.CreatedAt.Format(time.RFC3339))
+		}
+	}
+
+	fmt.Printf("%d user(s), %d conflict(s)\n", len(users), conflicts)
+
+	if conflicts > 0 {
+		os.Exit(1)
+	}
+
+	if *backfill {
+		stored, err := backfillEmailCanonical(ctx, repo, normalizer)
+		if err != nil {
+			log.Fatalf("error while storing canonical emails: %s", err)
+		}
+
+		fmt.Printf("stored %d canonical email(s)\n", stored)
+	}
+}
+
+// backfillEmailCanonical walks the users without a canonical email in batches
+// of backfillBatchSize and stores one for each of them.
+func backfillEmailCanonical(ctx context.Context, repo *postgres.AuthPostgres, normalizer *emailaddr.Normalizer) (int64, error) {
+	var stored int64
+	var after uuid.UUID
+
+	for {
+		users, err := repo.ListUsersWithoutEmailCanonical(ctx, after, backfillBatchSize)
+		if err != nil {
+			return stored, err
+		}
+
+		if len(users) == 0 {
+			return stored, nil
+		}
+
+		canonicalEmails := make(map[uuid.UUID]string, len(users))
+		for _, u := range users {
+			canonical, err := normalizer.Canonical(u.Email)
+			if err != nil {
+				continue
+			}
+			canonicalEmails[u.UserID] = canonical
+		}
+
+		updated, err := repo.BackfillEmailCanonical(ctx, canonicalEmails)
+		if err != nil {
+			return stored, err
+		}
+
+		stored += updated
+		after = users[len(users)-1].UserID
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/Verce11o/yata-auth/internal/domain"
+	"github.com/Verce11o/yata-auth/internal/lib/email/templates"
+	"github.com/google/uuid"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// email-preview renders an email template with sample data to stdout.
+//
+//	email-preview -template password_reset -locale ru -part html
+func main() {
+	name := flag.String("template", "verification", "template name: "+strings.Join(templates.Names(), ", "))
+	locale := flag.String("locale", "en", "recipient locale")
+	defaultLocale := flag.String("default-locale", "en", "default locale of the service")
+	part := flag.String("part", "all", "part to print: subject, text, html or all")
+	otp := flag.Bool("otp", false, "render a numeric code instead of a link")
+	flag.Parse()
+
+	eventType, ok := templates.EventType(*name)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown template %q, available: %s\n", *name, strings.Join(templates.Names(), ", "))
+		os.Exit(2)
+	}
+
+	renderer, err := templates.NewRenderer(*defaultLocale)
+	if err != nil {
+		log.Fatalf("error while loading templates: %s", err)
+	}
+
+	expiresAt := time.Now().Add(24 * time.Hour)
+
+	variables := map[string]string{
+		domain.EmailVariableLink: "https://example.com/action?code=" + uuid.NewString(),
+		"user_agent":             "Mozilla/5.0 (X11; Linux x86_64) Firefox/121.0",
+		"ip":                     "203.0.113.7",
+	}
+
+	if *otp {
+		delete(variables, domain.EmailVariableLink)
+		variables[domain.EmailVariableCode] = "492817"
+	}
+
+	rendered, err := renderer.Render(domain.EmailEvent{
+		EventID:       uuid.New(),
+		EventType:     eventType,
+		SchemaVersion: domain.EmailEventSchemaVersion,
+		OccurredAt:    time.Now(),
+		Recipient: domain.EmailRecipient{
+			Email:    "jane@example.com",
+			Username: "jane",
+			Locale:   *locale,
+		},
+		Variables: variables,
+		ExpiresAt: &expiresAt,
+	})
+
+	if err != nil {
+		log.Fatalf("error while rendering template: %s", err)
+	}
+
+	switch *part {
+	case "subject":
+		fmt.Println(rendered.Subject)
+	case "text":
+		fmt.Print(rendered.Text)
+	case "html":
+		fmt.Print(rendered.HTML)
+	case "all":
+		fmt.Printf("Subject: %s\n\n%s\n%s", rendered.Subject, rendered.Text, rendered.HTML)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown part %q\n", *part)
+		os.Exit(2)
+	}
+}
@@ -6,10 +6,12 @@ import (
 )
 
 type Config struct {
-	Postgres PostgresConfig `yaml:"postgres"`
-	Redis    RedisConfig    `yaml:"redis"`
-	RabbitMQ RabbitMQ       `yaml:"rabbitmq"`
-	App      App            `yaml:"app"`
+	Postgres  PostgresConfig  `yaml:"postgres"`
+	Redis     RedisConfig     `yaml:"redis"`
+	RabbitMQ  RabbitMQ        `yaml:"rabbitmq"`
+	Email     EmailConfig     `yaml:"email"`
+	App       App             `yaml:"app"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
 }
 
 type PostgresConfig struct {
@@ -37,19 +39,186 @@ type RabbitMQ struct {
 	QueueName    string `yaml:"queueName" env-required:"true"`
 	ConsumerTag  string `yaml:"consumerTag" env-required:"true"`
 	BindingKey   string `yaml:"bindingKey" env-required:"true"`
+
+	// ManagementPort is the port of the management api on Host, used to set
+	// the dead-letter policy of the queue.
+	ManagementPort        string `yaml:"managementPort" env-default:"15672"`
+	ChannelPoolSize       int    `yaml:"channelPoolSize" env-default:"8"`
+	ConfirmTimeoutSeconds int    `yaml:"confirmTimeoutSeconds" env-default:"5"`
+	RetryDelaysSeconds    []int  `yaml:"retryDelaysSeconds" env-default:"10,60,300"`
+	EmailFormat           string `yaml:"emailFormat" env-default:"compat"`
+}
+
+type EmailConfig struct {
+	// Transport is one of rabbitmq, smtp, file or log.
+	Transport string     `yaml:"transport" env-default:"rabbitmq"`
+	From      string     `yaml:"from" env-default:"no-reply@yata.local"`
+	SMTP      SMTPConfig `yaml:"smtp"`
+	File      FileConfig `yaml:"file"`
+}
+
+type SMTPConfig struct {
+	Host           string `yaml:"host"`
+	Port           string `yaml:"port" env-default:"587"`
+	Username       string `yaml:"username"`
+	Password       string `yaml:"password"`
+	StartTLS       bool   `yaml:"starttls" env-default:"true"`
+	TimeoutSeconds int    `yaml:"timeout_seconds" env-default:"10"`
+}
+
+type FileConfig struct {
+	Dir string `yaml:"dir" env-default:"maildir"`
+}
+
+type RateLimitConfig struct {
+	Enabled bool                       `yaml:"enabled" env-default:"true"`
+	Methods map[string]RateLimitPolicy `yaml:"methods"`
+}
+
+// RateLimitPolicy allows Rate requests per PeriodSeconds with bursts of up to
+// Burst requests. Key is one of ip, user or ip_user, user keys use the
+// authenticated caller and fall back to ip for anonymous requests.
+type RateLimitPolicy struct {
+	Rate          int    `yaml:"rate"`
+	PeriodSeconds int    `yaml:"period_seconds"`
+	Burst         int    `yaml:"burst"`
+	Key           string `yaml:"key" env-default:"ip"`
 }
 
 type App struct {
-	JWT                   JWTConfig `yaml:"jwt"`
-	Port                  string    `yaml:"port"`
-	EmailEndpoint         string    `yaml:"email-endpoint" env-required:"true"`
-	PasswordResetEndpoint string    `yaml:"password_reset_endpoint" env-required:"true"`
+	JWT                   JWTConfig                `yaml:"jwt"`
+	Hasher                HasherConfig             `yaml:"hasher"`
+	MFA                   MFAConfig                `yaml:"mfa"`
+	Lockout               LockoutConfig            `yaml:"lockout"`
+	Outbox                OutboxConfig             `yaml:"outbox"`
+	Codes                 CodesConfig              `yaml:"codes"`
+	PasswordPolicy        PasswordPolicyConfig     `yaml:"password_policy"`
+	EmailNormalization    EmailNormalizationConfig `yaml:"email_normalization"`
+	EmailDomains          EmailDomainsConfig       `yaml:"email_domains"`
+	Port                  string                   `yaml:"port"`
+	EmailEndpoint         string                   `yaml:"email-endpoint" env-required:"true"`
+	PasswordResetEndpoint string                   `yaml:"password_reset_endpoint" env-required:"true"`
+	DefaultLocale         string                   `yaml:"default_locale" env-default:"en"`
+	// TrustedProxies lists the CIDRs of proxies whose x-forwarded-* metadata
+	// is trusted, the peer address is used for everyone else.
+	TrustedProxies []string `yaml:"trusted_proxies"`
 }
 
 type JWTConfig struct {
-	Secret        string `yaml:"secret"`
-	TokenTTLHours int    `yaml:"token_ttl_hours"`
-	Salt          string `yaml:"salt"`
+	Secret                string `yaml:"secret"`
+	AccessTokenTTLMinutes int    `yaml:"access_token_ttl_minutes" env-default:"15"`
+	RefreshTokenTTLHours  int    `yaml:"refresh_token_ttl_hours" env-default:"720"`
+	Salt                  string `yaml:"salt"`
+
+	Issuer   string   `yaml:"issuer" env-default:"yata-auth"`
+	Audience string   `yaml:"audience"`
+	Scopes   []string `yaml:"scopes"`
+
+	// Keys enable asymmetric signing, Secret is only used when none are configured.
+	SigningKeyID string         `yaml:"signing_key_id"`
+	Keys         []JWTKeyConfig `yaml:"keys"`
+	JWKSPort     string         `yaml:"jwks_port" env-default:"4000"`
+}
+
+type JWTKeyConfig struct {
+	ID             string `yaml:"id"`
+	PrivateKeyPath string `yaml:"private_key_path"`
+	Retiring       bool   `yaml:"retiring"`
+}
+
+type PasswordPolicyConfig struct {
+	MinLength        int    `yaml:"min_length" env-default:"8"`
+	MaxLength        int    `yaml:"max_length" env-default:"128"`
+	RequireLower     bool   `yaml:"require_lower"`
+	RequireUpper     bool   `yaml:"require_upper"`
+	RequireDigit     bool   `yaml:"require_digit"`
+	RequireSymbol    bool   `yaml:"require_symbol"`
+	RejectUserInfo   bool   `yaml:"reject_user_info" env-default:"true"`
+	BreachedListPath string `yaml:"breached_list_path"`
+	BreachedMinCount int    `yaml:"breached_min_count" env-default:"1"`
+	HistoryDepth     int    `yaml:"history_depth" env-default:"5"`
+}
+
+// EmailNormalizationConfig controls how addresses are canonicalized to detect
+// duplicate registrations. Provider rules drop dots and "+tag" subaddresses
+// for providers that ignore them, such as gmail.com. Addresses are stored and
+// looked up without them.
+type EmailNormalizationConfig struct {
+	ProviderRules bool `yaml:"provider_rules"`
+}
+
+// EmailDomainsConfig restricts the email domains accepted at registration.
+// Allow-listed domains skip every other check, with AllowListOnly nothing
+// else is accepted. The list files hold one domain per line and are reloaded
+// when they change.
+type EmailDomainsConfig struct {
+	AllowListPath         string `yaml:"allow_list_path"`
+	DenyListPath          string `yaml:"deny_list_path"`
+	AllowListOnly         bool   `yaml:"allow_list_only"`
+	BlockDisposable       bool   `yaml:"block_disposable" env-default:"true"`
+	CheckMX               bool   `yaml:"check_mx"`
+	MXTimeoutMillis       int    `yaml:"mx_timeout_ms" env-default:"2000"`
+	ReloadIntervalSeconds int    `yaml:"reload_interval_seconds" env-default:"30"`
+}
+
+type CodesConfig struct {
+	Email    CodeConfig `yaml:"email"`
+	Password CodeConfig `yaml:"password"`
+
+	ResetGrantTTLMinutes int `yaml:"reset_grant_ttl_minutes" env-default:"15"`
+}
+
+// CodeConfig selects how verification codes of one purpose are delivered:
+// as a link with a random token or as a short numeric OTP typed into the app.
+type CodeConfig struct {
+	Format         string `yaml:"format" env-default:"link"`
+	LinkTTLMinutes int    `yaml:"link_ttl_minutes" env-default:"1440"`
+	OTPTTLMinutes  int    `yaml:"otp_ttl_minutes" env-default:"10"`
+	OTPLength      int    `yaml:"otp_length" env-default:"6"`
+	MaxAttempts    int    `yaml:"max_attempts" env-default:"5"`
+}
+
+type OutboxConfig struct {
+	PollIntervalSeconds int `yaml:"poll_interval_seconds" env-default:"2"`
+	BatchSize           int `yaml:"batch_size" env-default:"50"`
+	MaxAttempts         int `yaml:"max_attempts" env-default:"15"`
+	// LeaseSeconds is how long a relay owns the messages it claimed, it has to
+	// cover publishing a whole batch.
+	LeaseSeconds int `yaml:"lease_seconds" env-default:"300"`
+	// RetentionHours bounds how long undelivered messages, which hold plaintext
+	// links and codes, are kept before they are purged.
+	RetentionHours       int `yaml:"retention_hours" env-default:"72"`
+	PurgeIntervalMinutes int `yaml:"purge_interval_minutes" env-default:"60"`
+}
+
+type LockoutConfig struct {
+	MaxAccountFailures int `yaml:"max_account_failures" env-default:"5"`
+	MaxIPFailures      int `yaml:"max_ip_failures" env-default:"20"`
+	WindowMinutes      int `yaml:"window_minutes" env-default:"15"`
+	LockoutMinutes     int `yaml:"lockout_minutes" env-default:"15"`
+	BaseDelayMillis    int `yaml:"base_delay_millis" env-default:"500"`
+	MaxDelaySeconds    int `yaml:"max_delay_seconds" env-default:"30"`
+}
+
+type MFAConfig struct {
+	Issuer        string `yaml:"issuer" env-default:"Yata"`
+	EncryptionKey string `yaml:"encryption_key" env:"MFA_ENCRYPTION_KEY" env-required:"true"`
+	// RecoveryCodeKey keys the HMAC of stored recovery codes.
+	RecoveryCodeKey string `yaml:"recovery_code_key" env:"MFA_RECOVERY_CODE_KEY" env-required:"true"`
+}
+
+type HasherConfig struct {
+	Algorithm  string         `yaml:"algorithm" env-default:"argon2id"`
+	Argon2id   Argon2idConfig `yaml:"argon2id"`
+	BcryptCost int            `yaml:"bcrypt_cost" env-default:"12"`
+}
+
+type Argon2idConfig struct {
+	Memory      uint32 `yaml:"memory_kib" env-default:"65536"`
+	Iterations  uint32 `yaml:"iterations" env-default:"3"`
+	Parallelism uint8  `yaml:"parallelism" env-default:"2"`
+	SaltLength  uint32 `yaml:"salt_length" env-default:"16"`
+	KeyLength   uint32 `yaml:"key_length" env-default:"32"`
 }
 
 func LoadConfig() *Config {
@@ -1,30 +1,49 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/Verce11o/yata-auth/config"
 	authGrpc "github.com/Verce11o/yata-auth/internal/handler/grpc"
+	authHttp "github.com/Verce11o/yata-auth/internal/handler/http"
 	"github.com/Verce11o/yata-auth/internal/lib/auth_jwt"
+	"github.com/Verce11o/yata-auth/internal/lib/email"
+	"github.com/Verce11o/yata-auth/internal/lib/email/file"
+	"github.com/Verce11o/yata-auth/internal/lib/email/logsink"
 	"github.com/Verce11o/yata-auth/internal/lib/email/rabbitmq"
+	"github.com/Verce11o/yata-auth/internal/lib/email/smtp"
+	"github.com/Verce11o/yata-auth/internal/lib/email/templates"
+	"github.com/Verce11o/yata-auth/internal/lib/emailaddr"
+	"github.com/Verce11o/yata-auth/internal/lib/hasher"
 	"github.com/Verce11o/yata-auth/internal/lib/logger"
+	"github.com/Verce11o/yata-auth/internal/lib/metrics/meter"
 	"github.com/Verce11o/yata-auth/internal/lib/metrics/trace"
+	"github.com/Verce11o/yata-auth/internal/lib/passwordpolicy"
+	"github.com/Verce11o/yata-auth/internal/lib/ratelimit"
+	"github.com/Verce11o/yata-auth/internal/lib/totp"
 	"github.com/Verce11o/yata-auth/internal/repository/postgres"
 	"github.com/Verce11o/yata-auth/internal/repository/redis"
 	"github.com/Verce11o/yata-auth/internal/service"
 	pb "github.com/Verce11o/yata-protos/gen/go/sso"
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"go.opentelemetry.io/otel/propagation"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 func Run() {
 	log := logger.NewLogger()
 	cfg := config.LoadConfig()
 	tracer := trace.InitTracer("yata-auth")
+	meters := meter.InitMeter("yata-auth")
 	//tracer := trace.InitTracer("Yata-Auth")
 
 	// Init storages
@@ -34,16 +53,70 @@ func Run() {
 	rdb := redis.NewRedis(cfg)
 	redis := redis.NewAuthRedis(rdb, tracer.Tracer)
 
-	// Init rabbitmq client
-	amqpConn := rabbitmq.NewAmqpConnection(cfg.RabbitMQ)
-	emailPublisher := rabbitmq.NewEmailPublisher(amqpConn, log, tracer.Tracer, cfg.RabbitMQ)
+	// Init email transport
+	emailPublisher, err := newEmailTransport(log, tracer.Tracer, cfg)
+	if err != nil {
+		log.Fatalf("error while init email transport: %s", err)
+	}
+
+	// Start email outbox relay
+	outboxRelay := service.NewOutboxRelay(log, tracer.Tracer, repo, emailPublisher,
+		time.Duration(cfg.App.Outbox.PollIntervalSeconds)*time.Second, cfg.App.Outbox.BatchSize, cfg.App.Outbox.MaxAttempts, time.Duration(cfg.App.Outbox.LeaseSeconds)*time.Second,
+		time.Duration(cfg.App.Outbox.RetentionHours)*time.Hour, time.Duration(cfg.App.Outbox.PurgeIntervalMinutes)*time.Minute)
+
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	relayDone := make(chan struct{})
+
+	go func() {
+		defer close(relayDone)
+		outboxRelay.Run(relayCtx)
+	}()
+
+	// Init password hasher
+	passwordHasher, err := hasher.NewPasswordHasher(cfg.App.Hasher, cfg.App.JWT.Salt)
+	if err != nil {
+		log.Fatalf("error while init password hasher: %s", err)
+	}
+
+	totpService, err := totp.NewTOTP(cfg.App.MFA)
+	if err != nil {
+		log.Fatalf("error while init totp: %s", err)
+	}
 
-	authService := service.NewAuthService(log, tracer.Tracer, repo, redis, emailPublisher, cfg.App.EmailEndpoint, cfg.App.PasswordResetEndpoint, auth_jwt.MakeJWTService(cfg.App.JWT))
+	passwordPolicy, err := passwordpolicy.NewPolicy(cfg.App.PasswordPolicy, passwordHasher.MaxPasswordBytes())
+	if err != nil {
+		log.Fatalf("error while init password policy: %s", err)
+	}
+
+	domainFilter, err := emailaddr.NewDomainFilter(log, cfg.App.EmailDomains, net.DefaultResolver, meters.Meter)
+	if err != nil {
+		log.Fatalf("error while init email domain filter: %s", err)
+	}
+
+	filterCtx, stopFilter := context.WithCancel(context.Background())
+	go domainFilter.Run(filterCtx)
+
+	jwtService, err := auth_jwt.MakeJWTService(cfg.App.JWT)
+	if err != nil {
+		log.Fatalf("error while init jwt service: %s", err)
+	}
+
+	authService := service.NewAuthService(log, tracer.Tracer, repo, redis, cfg.App.EmailEndpoint, cfg.App.PasswordResetEndpoint, cfg.App.DefaultLocale, cfg.App.Codes, passwordPolicy, emailaddr.NewNormalizer(cfg.App.EmailNormalization), domainFilter, jwtService, passwordHasher, totpService, []byte(cfg.App.MFA.RecoveryCodeKey), cfg.App.Lockout)
+
+	trustedProxies, err := authGrpc.ParseTrustedProxies(cfg.App.TrustedProxies)
+	if err != nil {
+		log.Fatalf("error while parsing trusted proxies: %s", err)
+	}
 
-	s := grpc.NewServer(grpc.UnaryInterceptor(otelgrpc.UnaryServerInterceptor(
-		otelgrpc.WithTracerProvider(tracer.Provider),
-		otelgrpc.WithPropagators(propagation.TraceContext{}),
-	)))
+	s := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		otelgrpc.UnaryServerInterceptor(
+			otelgrpc.WithTracerProvider(tracer.Provider),
+			otelgrpc.WithPropagators(propagation.TraceContext{}),
+		),
+		authGrpc.ClientInfoInterceptor(trustedProxies),
+		authGrpc.RateLimitInterceptor(log, ratelimit.NewLimiter(rdb), jwtService, cfg.RateLimit),
+		authGrpc.ValidationInterceptor(),
+	))
 
 	pb.RegisterAuthServer(s, authGrpc.NewAuthGRPC(log, tracer.Tracer, authService))
 
@@ -60,6 +133,19 @@ func Run() {
 
 	log.Info(fmt.Sprintf("server listening at %s", lis.Addr().String()))
 
+	jwksServer := &http.Server{
+		Addr:    fmt.Sprintf(":%s", cfg.App.JWT.JWKSPort),
+		Handler: authHttp.NewJWKSHandler(log, jwtService).Routes(),
+	}
+
+	go func() {
+		if err := jwksServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Infof("error while listen jwks server: %s", err)
+		}
+	}()
+
+	log.Info(fmt.Sprintf("jwks server listening at %s", jwksServer.Addr))
+
 	defer log.Sync()
 
 	quit := make(chan os.Signal, 1)
@@ -68,8 +154,47 @@ func Run() {
 
 	s.GracefulStop()
 
+	stopFilter()
+
+	stopRelay()
+	<-relayDone
+
+	if err := emailPublisher.Close(); err != nil {
+		log.Infof("error while close email transport: %s", err)
+	}
+
+	if err := jwksServer.Shutdown(context.Background()); err != nil {
+		log.Infof("error while shutdown jwks server: %s", err)
+	}
+
 	if err := db.Close(); err != nil {
 		log.Infof("error while close db: %s", err)
 	}
 
+	if err := meters.Provider.Shutdown(context.Background()); err != nil {
+		log.Infof("error while shutdown meter provider: %s", err)
+	}
+
+}
+
+func newEmailTransport(log *zap.SugaredLogger, tracer oteltrace.Tracer, cfg *config.Config) (email.Transport, error) {
+	if cfg.Email.Transport == email.TransportRabbitMQ {
+		return rabbitmq.NewEmailPublisher(log, tracer, cfg.RabbitMQ)
+	}
+
+	renderer, err := templates.NewRenderer(cfg.App.DefaultLocale)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.Email.Transport {
+	case email.TransportSMTP:
+		return smtp.NewEmailSender(log, tracer, cfg.Email, renderer), nil
+	case email.TransportFile:
+		return file.NewEmailSink(cfg.Email, renderer)
+	case email.TransportLog:
+		return logsink.NewEmailSink(log, renderer), nil
+	}
+
+	return nil, fmt.Errorf("unknown email transport %q", cfg.Email.Transport)
 }
@@ -0,0 +1,40 @@
+package domain
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	EmailEventSchemaVersion = 1
+
+	EmailEventVerification    = "user.email_verification"
+	EmailEventPasswordReset   = "user.password_reset"
+	EmailEventAccountLocked   = "user.account_locked"
+	EmailEventNewLogin        = "user.new_login"
+	EmailEventPasswordChanged = "user.password_changed"
+
+	// EmailVariableLink holds the action link of verification and reset emails.
+	EmailVariableLink = "link"
+	// EmailVariableCode holds the numeric code of verification and reset emails.
+	EmailVariableCode = "code"
+)
+
+// EmailEvent is the versioned envelope of every email the service sends.
+type EmailEvent struct {
+	EventID       uuid.UUID         `json:"event_id"`
+	EventType     string            `json:"event_type"`
+	SchemaVersion int               `json:"schema_version"`
+	OccurredAt    time.Time         `json:"occurred_at"`
+	CorrelationID string            `json:"correlation_id,omitempty"`
+	TraceID       string            `json:"trace_id,omitempty"`
+	Recipient     EmailRecipient    `json:"recipient"`
+	Variables     map[string]string `json:"variables,omitempty"`
+	ExpiresAt     *time.Time        `json:"expires_at,omitempty"`
+}
+
+type EmailRecipient struct {
+	Email    string `json:"email"`
+	Username string `json:"username,omitempty"`
+	Locale   string `json:"locale,omitempty"`
+}
@@ -0,0 +1,25 @@
+package domain
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type UserMFA struct {
+	UserID      uuid.UUID  `json:"user_id" db:"user_id"`
+	Secret      string     `json:"-" db:"secret"`
+	Enabled     bool       `json:"enabled" db:"enabled"`
+	ConfirmedAt *time.Time `json:"confirmed_at" db:"confirmed_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+type MFAEnrollment struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauth_uri"`
+}
+
+// MFAChallenge is stored between the password and the second factor step of a login.
+type MFAChallenge struct {
+	UserID uuid.UUID  `json:"user_id"`
+	Client ClientInfo `json:"client"`
+}
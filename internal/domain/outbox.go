@@ -0,0 +1,11 @@
+package domain
+
+import "time"
+
+type OutboxMessage struct {
+	ID           int64     `json:"id" db:"id"`
+	Payload      []byte    `json:"payload" db:"payload"`
+	TraceContext []byte    `json:"trace_context" db:"trace_context"`
+	Attempts     int       `json:"attempts" db:"attempts"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type Session struct {
+	SessionID  uuid.UUID  `json:"session_id" db:"session_id"`
+	UserID     uuid.UUID  `json:"user_id" db:"user_id"`
+	UserAgent  string     `json:"user_agent" db:"user_agent"`
+	IP         string     `json:"ip" db:"ip"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at" db:"last_seen_at"`
+	ExpireDate time.Time  `json:"expire_date" db:"expire_date"`
+	RevokedAt  *time.Time `json:"revoked_at" db:"revoked_at"`
+	Current    bool       `json:"-" db:"-"`
+}
+
+func (s *Session) IsActive() bool {
+	return s.RevokedAt == nil && time.Now().UTC().Before(s.ExpireDate)
+}
+
+// ClientInfo describes the device a request was made from.
+type ClientInfo struct {
+	UserAgent string `json:"user_agent"`
+	IP        string `json:"ip"`
+	Locale    string `json:"locale,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
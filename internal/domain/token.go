@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Tokens is returned by a login, MFAToken is set instead of the token pair
+// when the user still has to pass the second factor.
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	MFAToken     string `json:"mfa_token,omitempty"`
+}
+
+type RefreshToken struct {
+	TokenID    uuid.UUID  `json:"token_id" db:"token_id"`
+	FamilyID   uuid.UUID  `json:"family_id" db:"family_id"`
+	UserID     uuid.UUID  `json:"user_id" db:"user_id"`
+	TokenHash  string     `json:"token_hash" db:"token_hash"`
+	ExpireDate time.Time  `json:"expire_date" db:"expire_date"`
+	RevokedAt  *time.Time `json:"revoked_at" db:"revoked_at"`
+	ReplacedBy *uuid.UUID `json:"replaced_by" db:"replaced_by"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	// AccessTokenID is the jti of the access token issued with this refresh token.
+	AccessTokenID *uuid.UUID `json:"access_token_id" db:"access_token_id"`
+}
+
+// TokenIntrospection follows RFC 7662, only Active is set for inactive tokens.
+type TokenIntrospection struct {
+	Active    bool      `json:"active"`
+	UserID    string    `json:"sub,omitempty"`
+	Scope     string    `json:"scope,omitempty"`
+	TokenID   string    `json:"jti,omitempty"`
+	Issuer    string    `json:"iss,omitempty"`
+	Audience  []string  `json:"aud,omitempty"`
+	ExpiresAt time.Time `json:"exp,omitempty"`
+	IssuedAt  time.Time `json:"iat,omitempty"`
+}
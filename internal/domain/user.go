@@ -6,13 +6,15 @@ import (
 )
 
 type User struct {
-	UserID       uuid.UUID `json:"id" db:"user_id"`
-	Username     string    `json:"username" db:"username"`
-	Email        string    `json:"email" db:"email"`
-	PasswordHash []byte    `json:"passwordHash" db:"password"`
-	IsVerified   bool      `json:"is_verified" db:"is_verified"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+	UserID         uuid.UUID `json:"id" db:"user_id"`
+	Username       string    `json:"username" db:"username"`
+	Email          string    `json:"email" db:"email"`
+	EmailCanonical *string   `json:"-" db:"email_canonical"`
+	PasswordHash   []byte    `json:"passwordHash" db:"password"`
+	IsVerified     bool      `json:"is_verified" db:"is_verified"`
+	TokenVersion   int       `json:"token_version" db:"token_version"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
 }
 
 type SendUserEmailRequest struct {
@@ -21,9 +23,17 @@ type SendUserEmailRequest struct {
 	Code string `json:"code"`
 }
 
+const (
+	CodeFormatLink = "link"
+	CodeFormatOTP  = "otp"
+)
+
 type VerificationCode struct {
+	ID         int64     `json:"id" db:"id"`
 	Type       string    `json:"type" db:"type"`
-	Code       uuid.UUID `json:"code" db:"code"`
+	CodeHash   string    `json:"-" db:"code_hash"`
+	Format     string    `json:"format" db:"format"`
+	Attempts   int       `json:"attempts" db:"attempts"`
 	UserID     uuid.UUID `json:"user_id" db:"user_id"`
 	ExpireDate time.Time `json:"expire_date" db:"expire_date"`
 }
@@ -0,0 +1,35 @@
+package grpc
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Verce11o/yata-auth/internal/lib/grpc_errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+)
+
+// statusError converts a service error into a gRPC status and attaches the
+// field violations of a grpc_errors.ValidationError as errdetails.BadRequest.
+func statusError(method string, err error) error {
+	st := status.New(grpc_errors.ParseGRPCErrStatusCode(err), fmt.Sprintf("%s: %v", method, err))
+
+	var validationErr *grpc_errors.ValidationError
+	if !errors.As(err, &validationErr) {
+		return st.Err()
+	}
+
+	badRequest := &errdetails.BadRequest{}
+	for _, v := range validationErr.Violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       v.Field,
+			Description: v.Description,
+		})
+	}
+
+	withDetails, detailsErr := st.WithDetails(badRequest)
+	if detailsErr != nil {
+		return st.Err()
+	}
+
+	return withDetails.Err()
+}
@@ -2,12 +2,10 @@ package grpc
 
 import (
 	"context"
-	"github.com/Verce11o/yata-auth/internal/lib/grpc_errors"
 	"github.com/Verce11o/yata-auth/internal/service"
 	pb "github.com/Verce11o/yata-protos/gen/go/sso"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
-	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
@@ -31,7 +29,7 @@ func (a *AuthGRPC) Register(ctx context.Context, input *pb.RegisterRequest) (*pb
 	if err != nil {
 		a.log.Errorf("Register: %v", err.Error())
 
-		return nil, status.Errorf(grpc_errors.ParseGRPCErrStatusCode(err), "Register: %v", err)
+		return nil, statusError("Register", err)
 	}
 
 	return &pb.RegisterResponse{UserId: id}, nil
@@ -42,10 +40,10 @@ func (a *AuthGRPC) VerifyUser(ctx context.Context, input *pb.VerifyRequest) (*pb
 	ctx, span := a.tracer.Start(ctx, "VerifyUser")
 	defer span.End()
 
-	err := a.service.VerifyUser(ctx, input)
+	err := a.service.VerifyUser(ctx, input, clientInfo(ctx))
 	if err != nil {
 		a.log.Errorf("VerifyUser: %v", err.Error())
-		return nil, status.Errorf(grpc_errors.ParseGRPCErrStatusCode(err), "VerifyUser: %v", err)
+		return nil, statusError("VerifyUser", err)
 	}
 
 	return &pb.VerifyResponse{}, nil
@@ -59,7 +57,7 @@ func (a *AuthGRPC) CheckVerify(ctx context.Context, input *pb.CheckVerifyRequest
 	err := a.service.CheckVerify(ctx, input)
 
 	if err != nil {
-		return nil, status.Errorf(grpc_errors.ParseGRPCErrStatusCode(err), "CheckVerify: %v", err)
+		return nil, statusError("CheckVerify", err)
 	}
 
 	return &pb.CheckVerifyResponse{}, nil
@@ -69,14 +67,60 @@ func (a *AuthGRPC) Login(ctx context.Context, input *pb.LoginRequest) (*pb.Login
 	ctx, span := a.tracer.Start(ctx, "Login")
 	defer span.End()
 
-	token, err := a.service.Login(ctx, input)
+	tokens, err := a.service.Login(ctx, input, clientInfo(ctx))
 
 	if err != nil {
 		a.log.Errorf("Login: %v", err.Error())
-		return nil, status.Errorf(grpc_errors.ParseGRPCErrStatusCode(err), "Login: %v", err)
+		return nil, statusError("Login", err)
 	}
 
-	return &pb.LoginResponse{Token: token}, nil
+	if tokens.MFAToken != "" {
+		return &pb.LoginResponse{MfaRequired: true, MfaToken: tokens.MFAToken}, nil
+	}
+
+	return &pb.LoginResponse{Token: tokens.AccessToken, RefreshToken: tokens.RefreshToken}, nil
+}
+
+func (a *AuthGRPC) Refresh(ctx context.Context, input *pb.RefreshRequest) (*pb.RefreshResponse, error) {
+	ctx, span := a.tracer.Start(ctx, "Refresh")
+	defer span.End()
+
+	tokens, err := a.service.Refresh(ctx, input)
+
+	if err != nil {
+		a.log.Errorf("Refresh: %v", err.Error())
+		return nil, statusError("Refresh", err)
+	}
+
+	return &pb.RefreshResponse{Token: tokens.AccessToken, RefreshToken: tokens.RefreshToken}, nil
+}
+
+func (a *AuthGRPC) ValidateToken(ctx context.Context, input *pb.ValidateTokenRequest) (*pb.ValidateTokenResponse, error) {
+	ctx, span := a.tracer.Start(ctx, "ValidateToken")
+	defer span.End()
+
+	token, err := a.service.ValidateToken(ctx, input)
+
+	if err != nil {
+		a.log.Errorf("ValidateToken: %v", err.Error())
+		return nil, statusError("ValidateToken", err)
+	}
+
+	if !token.Active {
+		return &pb.ValidateTokenResponse{Active: false}, nil
+	}
+
+	return &pb.ValidateTokenResponse{
+		Active:    true,
+		UserId:    token.UserID,
+		Scope:     token.Scope,
+		TokenType: "Bearer",
+		Jti:       token.TokenID,
+		Iss:       token.Issuer,
+		Aud:       token.Audience,
+		Exp:       token.ExpiresAt.Unix(),
+		Iat:       token.IssuedAt.Unix(),
+	}, nil
 }
 
 func (a *AuthGRPC) GetUserByID(ctx context.Context, input *pb.GetUserRequest) (*pb.GetUserResponse, error) {
@@ -105,10 +149,10 @@ func (a *AuthGRPC) ForgotPassword(ctx context.Context, input *pb.ForgotPasswordR
 	ctx, span := a.tracer.Start(ctx, "ForgotPassword")
 	defer span.End()
 
-	err := a.service.ForgotPassword(ctx, input)
+	err := a.service.ForgotPassword(ctx, input, clientInfo(ctx))
 	if err != nil {
 		a.log.Errorf("ForgotPassword: %v", err.Error())
-		return nil, status.Errorf(grpc_errors.ParseGRPCErrStatusCode(err), "ForgotPassword: %v", err)
+		return nil, statusError("ForgotPassword", err)
 	}
 
 	return &pb.ForgotPasswordResponse{}, nil
@@ -118,12 +162,12 @@ func (a *AuthGRPC) VerifyPassword(ctx context.Context, input *pb.VerifyPasswordR
 	ctx, span := a.tracer.Start(ctx, "VerifyPassword")
 	defer span.End()
 
-	err := a.service.VerifyPassword(ctx, input)
+	resetToken, err := a.service.VerifyPassword(ctx, input)
 	if err != nil {
 		a.log.Errorf("VerifyPassword: %v", err.Error())
-		return nil, status.Errorf(grpc_errors.ParseGRPCErrStatusCode(err), "VerifyPassword: %v", err)
+		return nil, statusError("VerifyPassword", err)
 	}
-	return &pb.VerifyPasswordResponse{}, nil
+	return &pb.VerifyPasswordResponse{ResetToken: resetToken}, nil
 
 }
 
@@ -134,9 +178,138 @@ func (a *AuthGRPC) ResetPassword(ctx context.Context, input *pb.ResetPasswordReq
 	err := a.service.ResetPassword(ctx, input)
 	if err != nil {
 		a.log.Errorf("ResetPassword: %v", err.Error())
-		return nil, status.Errorf(grpc_errors.ParseGRPCErrStatusCode(err), "ResetPassword: %v", err)
+		return nil, statusError("ResetPassword", err)
 	}
 
 	return &pb.ResetPasswordResponse{}, nil
 
 }
+
+func (a *AuthGRPC) ChangePassword(ctx context.Context, input *pb.ChangePasswordRequest) (*pb.ChangePasswordResponse, error) {
+	ctx, span := a.tracer.Start(ctx, "ChangePassword")
+	defer span.End()
+
+	accessToken, err := a.service.ChangePassword(ctx, bearerToken(ctx), input, clientInfo(ctx))
+	if err != nil {
+		a.log.Errorf("ChangePassword: %v", err.Error())
+		return nil, statusError("ChangePassword", err)
+	}
+
+	return &pb.ChangePasswordResponse{AccessToken: accessToken}, nil
+}
+
+func (a *AuthGRPC) ListSessions(ctx context.Context, input *pb.ListSessionsRequest) (*pb.ListSessionsResponse, error) {
+	ctx, span := a.tracer.Start(ctx, "ListSessions")
+	defer span.End()
+
+	sessions, err := a.service.ListSessions(ctx, bearerToken(ctx))
+	if err != nil {
+		a.log.Errorf("ListSessions: %v", err.Error())
+		return nil, statusError("ListSessions", err)
+	}
+
+	res := make([]*pb.Session, 0, len(sessions))
+	for _, session := range sessions {
+		res = append(res, &pb.Session{
+			SessionId:  session.SessionID.String(),
+			UserAgent:  session.UserAgent,
+			Ip:         session.IP,
+			Current:    session.Current,
+			CreatedAt:  timestamppb.New(session.CreatedAt),
+			LastSeenAt: timestamppb.New(session.LastSeenAt),
+		})
+	}
+
+	return &pb.ListSessionsResponse{Sessions: res}, nil
+}
+
+func (a *AuthGRPC) RevokeSession(ctx context.Context, input *pb.RevokeSessionRequest) (*pb.RevokeSessionResponse, error) {
+	ctx, span := a.tracer.Start(ctx, "RevokeSession")
+	defer span.End()
+
+	err := a.service.RevokeSession(ctx, bearerToken(ctx), input)
+	if err != nil {
+		a.log.Errorf("RevokeSession: %v", err.Error())
+		return nil, statusError("RevokeSession", err)
+	}
+
+	return &pb.RevokeSessionResponse{}, nil
+}
+
+func (a *AuthGRPC) RevokeOtherSessions(ctx context.Context, input *pb.RevokeOtherSessionsRequest) (*pb.RevokeOtherSessionsResponse, error) {
+	ctx, span := a.tracer.Start(ctx, "RevokeOtherSessions")
+	defer span.End()
+
+	err := a.service.RevokeOtherSessions(ctx, bearerToken(ctx))
+	if err != nil {
+		a.log.Errorf("RevokeOtherSessions: %v", err.Error())
+		return nil, statusError("RevokeOtherSessions", err)
+	}
+
+	return &pb.RevokeOtherSessionsResponse{}, nil
+}
+
+func (a *AuthGRPC) RevokeAllSessions(ctx context.Context, input *pb.RevokeAllSessionsRequest) (*pb.RevokeAllSessionsResponse, error) {
+	ctx, span := a.tracer.Start(ctx, "RevokeAllSessions")
+	defer span.End()
+
+	err := a.service.RevokeAllSessions(ctx, bearerToken(ctx))
+	if err != nil {
+		a.log.Errorf("RevokeAllSessions: %v", err.Error())
+		return nil, statusError("RevokeAllSessions", err)
+	}
+
+	return &pb.RevokeAllSessionsResponse{}, nil
+}
+
+func (a *AuthGRPC) EnrollTOTP(ctx context.Context, input *pb.EnrollTOTPRequest) (*pb.EnrollTOTPResponse, error) {
+	ctx, span := a.tracer.Start(ctx, "EnrollTOTP")
+	defer span.End()
+
+	enrollment, err := a.service.EnrollTOTP(ctx, bearerToken(ctx))
+	if err != nil {
+		a.log.Errorf("EnrollTOTP: %v", err.Error())
+		return nil, statusError("EnrollTOTP", err)
+	}
+
+	return &pb.EnrollTOTPResponse{Secret: enrollment.Secret, OtpauthUri: enrollment.OtpauthURI}, nil
+}
+
+func (a *AuthGRPC) ConfirmTOTP(ctx context.Context, input *pb.ConfirmTOTPRequest) (*pb.ConfirmTOTPResponse, error) {
+	ctx, span := a.tracer.Start(ctx, "ConfirmTOTP")
+	defer span.End()
+
+	codes, err := a.service.ConfirmTOTP(ctx, bearerToken(ctx), input)
+	if err != nil {
+		a.log.Errorf("ConfirmTOTP: %v", err.Error())
+		return nil, statusError("ConfirmTOTP", err)
+	}
+
+	return &pb.ConfirmTOTPResponse{RecoveryCodes: codes}, nil
+}
+
+func (a *AuthGRPC) VerifyMFA(ctx context.Context, input *pb.VerifyMFARequest) (*pb.VerifyMFAResponse, error) {
+	ctx, span := a.tracer.Start(ctx, "VerifyMFA")
+	defer span.End()
+
+	tokens, err := a.service.VerifyMFA(ctx, input)
+	if err != nil {
+		a.log.Errorf("VerifyMFA: %v", err.Error())
+		return nil, statusError("VerifyMFA", err)
+	}
+
+	return &pb.VerifyMFAResponse{Token: tokens.AccessToken, RefreshToken: tokens.RefreshToken}, nil
+}
+
+func (a *AuthGRPC) RegenerateRecoveryCodes(ctx context.Context, input *pb.RegenerateRecoveryCodesRequest) (*pb.RegenerateRecoveryCodesResponse, error) {
+	ctx, span := a.tracer.Start(ctx, "RegenerateRecoveryCodes")
+	defer span.End()
+
+	codes, err := a.service.RegenerateRecoveryCodes(ctx, bearerToken(ctx), input)
+	if err != nil {
+		a.log.Errorf("RegenerateRecoveryCodes: %v", err.Error())
+		return nil, statusError("RegenerateRecoveryCodes", err)
+	}
+
+	return &pb.RegenerateRecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
@@ -0,0 +1,171 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"github.com/Verce11o/yata-auth/internal/domain"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"net/netip"
+	"strings"
+)
+
+// bearerToken returns the access token from the authorization metadata.
+func bearerToken(ctx context.Context) string {
+	token, ok := strings.CutPrefix(firstMetadataValue(ctx, "authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+type clientInfoKey struct{}
+
+// ClientInfoInterceptor resolves the caller once per request. The forwarded
+// headers are only trusted when the request comes from one of the trusted
+// proxies, otherwise the peer address is used.
+func ClientInfoInterceptor(trustedProxies []netip.Prefix) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handler(context.WithValue(ctx, clientInfoKey{}, resolveClientInfo(ctx, trustedProxies)), req)
+	}
+}
+
+// ParseTrustedProxies parses CIDRs and single addresses.
+func ParseTrustedProxies(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", value, err)
+			}
+
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", value, err)
+		}
+
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+// clientInfo returns the caller resolved by ClientInfoInterceptor.
+func clientInfo(ctx context.Context) domain.ClientInfo {
+	if info, ok := ctx.Value(clientInfoKey{}).(domain.ClientInfo); ok {
+		return info
+	}
+
+	return resolveClientInfo(ctx, nil)
+}
+
+func resolveClientInfo(ctx context.Context, trustedProxies []netip.Prefix) domain.ClientInfo {
+	info := domain.ClientInfo{
+		UserAgent: firstMetadataValue(ctx, "user-agent"),
+		Locale:    preferredLocale(firstMetadataValue(ctx, "accept-language")),
+		RequestID: firstMetadataValue(ctx, "x-request-id"),
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return info
+	}
+
+	addrPort, err := netip.ParseAddrPort(p.Addr.String())
+	if err != nil {
+		return info
+	}
+
+	ip := addrPort.Addr().Unmap()
+	info.IP = ip.String()
+
+	if !isTrustedProxy(ip, trustedProxies) {
+		return info
+	}
+
+	if userAgent := firstMetadataValue(ctx, "x-forwarded-user-agent"); userAgent != "" {
+		info.UserAgent = userAgent
+	}
+
+	// every proxy appends the address it received the request from, so the
+	// client is the rightmost address that is not a trusted proxy
+	hops := forwardedFor(ctx)
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(hops[i])
+		if err != nil {
+			break
+		}
+
+		info.IP = hop.Unmap().String()
+
+		if !isTrustedProxy(hop.Unmap(), trustedProxies) {
+			break
+		}
+	}
+
+	return info
+}
+
+// preferredLocale takes the first language of an accept-language header.
+func preferredLocale(acceptLanguage string) string {
+	locale, _, _ := strings.Cut(acceptLanguage, ",")
+	locale, _, _ = strings.Cut(locale, ";")
+	locale = strings.TrimSpace(locale)
+
+	if locale == "*" {
+		return ""
+	}
+
+	return locale
+}
+
+func isTrustedProxy(ip netip.Addr, trustedProxies []netip.Prefix) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// forwardedFor returns the x-forwarded-for addresses in order, across all
+// values of the header.
+func forwardedFor(ctx context.Context) []string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	var hops []string
+	for _, value := range md.Get("x-forwarded-for") {
+		for _, hop := range strings.Split(value, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+
+	return hops
+}
+
+func firstMetadataValue(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
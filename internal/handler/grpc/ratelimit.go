@@ -0,0 +1,109 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"github.com/Verce11o/yata-auth/config"
+	"github.com/Verce11o/yata-auth/internal/lib/auth_jwt"
+	"github.com/Verce11o/yata-auth/internal/lib/ratelimit"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"math"
+	"path"
+	"time"
+)
+
+const (
+	rateLimitByIP     = "ip"
+	rateLimitByUser   = "user"
+	rateLimitByIPUser = "ip_user"
+)
+
+// RateLimitInterceptor applies the per-method policies from config. Methods
+// without a policy are not limited and redis failures let the request through.
+// IP keys use the resolved client IP, user keys the subject of a valid bearer
+// token.
+func RateLimitInterceptor(log *zap.SugaredLogger, limiter *ratelimit.Limiter, jwtService *auth_jwt.JWTService, cfg config.RateLimitConfig) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		method := path.Base(info.FullMethod)
+
+		policy, ok := cfg.Methods[method]
+		if !cfg.Enabled || !ok {
+			return handler(ctx, req)
+		}
+
+		limit := ratelimit.Limit{
+			Rate:   policy.Rate,
+			Period: time.Duration(policy.PeriodSeconds) * time.Second,
+			Burst:  policy.Burst,
+		}
+
+		var keys []string
+		for _, key := range rateLimitKeys(ctx, jwtService, policy.Key) {
+			keys = append(keys, fmt.Sprintf("%s:%s", method, key))
+		}
+
+		allowed, retryAfter, err := limiter.Allow(ctx, limit, keys...)
+
+		if err != nil {
+			log.Errorf("RateLimitInterceptor: %v", err.Error())
+			return handler(ctx, req)
+		}
+
+		if !allowed {
+			return nil, rateLimitError(ctx, method, retryAfter)
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// rateLimitKeys never trusts identifiers from the request body, requests
+// without a valid bearer token are limited by IP only.
+func rateLimitKeys(ctx context.Context, jwtService *auth_jwt.JWTService, keyBy string) []string {
+	ip := "ip:" + clientInfo(ctx).IP
+
+	var userID string
+	if keyBy == rateLimitByUser || keyBy == rateLimitByIPUser {
+		if claims, err := jwtService.ParseToken(bearerToken(ctx)); err == nil && claims.UserID != "" {
+			userID = "user:" + claims.UserID
+		}
+	}
+
+	switch keyBy {
+	case rateLimitByUser:
+		if userID != "" {
+			return []string{userID}
+		}
+		return []string{ip}
+	case rateLimitByIPUser:
+		if userID != "" {
+			return []string{ip, userID}
+		}
+		return []string{ip}
+	default:
+		return []string{ip}
+	}
+}
+
+func rateLimitError(ctx context.Context, method string, retryAfter time.Duration) error {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+
+	if err := grpc.SetHeader(ctx, metadata.Pairs("retry-after", fmt.Sprint(seconds))); err != nil {
+		return status.Errorf(codes.ResourceExhausted, "%s: rate limit exceeded", method)
+	}
+
+	st, err := status.New(codes.ResourceExhausted, fmt.Sprintf("%s: rate limit exceeded", method)).
+		WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)})
+
+	if err != nil {
+		return status.Errorf(codes.ResourceExhausted, "%s: rate limit exceeded", method)
+	}
+
+	return st.Err()
+}
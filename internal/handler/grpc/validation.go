@@ -0,0 +1,211 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"github.com/Verce11o/yata-auth/internal/lib/grpc_errors"
+	pb "github.com/Verce11o/yata-protos/gen/go/sso"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"net/mail"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxEmailLength    = 254
+	minUsernameLength = 3
+	maxUsernameLength = 32
+	maxPasswordLength = 1024
+	maxTokenLength    = 4096
+	minOTPLength      = 4
+	maxOTPLength      = 12
+	totpCodeLength    = 6
+)
+
+var (
+	usernamePattern     = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+	digitsPattern       = regexp.MustCompile(`^[0-9]+$`)
+	recoveryCodePattern = regexp.MustCompile(`^[A-Za-z2-7]{4}(-?[A-Za-z2-7]{4}){3}$`)
+)
+
+// ValidationInterceptor rejects malformed requests with codes.InvalidArgument
+// and a BadRequest detail listing every invalid field, before they reach the
+// service and storage layers.
+func ValidationInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if violations := validateRequest(req); len(violations) > 0 {
+			return nil, statusError(path.Base(info.FullMethod), &grpc_errors.ValidationError{
+				Err:        grpc_errors.ErrInvalidArgument,
+				Violations: violations,
+			})
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// validateRequest declares the rules of every Auth request message.
+func validateRequest(req any) []grpc_errors.FieldViolation {
+	v := &validator{}
+
+	switch r := req.(type) {
+	case *pb.RegisterRequest:
+		v.username("username", r.GetUsername())
+		v.email("email", r.GetEmail())
+		v.password("password", r.GetPassword())
+	case *pb.VerifyRequest:
+		v.uuid("user_id", r.GetUserId())
+	case *pb.CheckVerifyRequest:
+		v.verificationCode("code", r.GetCode(), r.GetUserId())
+	case *pb.LoginRequest:
+		v.email("email", r.GetEmail())
+		v.password("password", r.GetPassword())
+	case *pb.GetUserRequest:
+		v.uuid("user_id", r.GetUserId())
+	case *pb.ForgotPasswordRequest:
+		v.uuid("user_id", r.GetUserId())
+	case *pb.VerifyPasswordRequest:
+		v.verificationCode("code", r.GetCode(), r.GetUserId())
+	case *pb.ResetPasswordRequest:
+		v.token("reset_token", r.GetResetToken())
+		v.password("password", r.GetPassword())
+		v.password("password_re", r.GetPasswordRe())
+	case *pb.RefreshRequest:
+		v.token("refresh_token", r.GetRefreshToken())
+	case *pb.ValidateTokenRequest:
+		v.token("token", r.GetToken())
+	case *pb.RevokeSessionRequest:
+		v.uuid("session_id", r.GetSessionId())
+	case *pb.ConfirmTOTPRequest:
+		v.totpCode("code", r.GetCode())
+	case *pb.VerifyMFARequest:
+		v.token("mfa_token", r.GetMfaToken())
+		if r.GetRecoveryCode() != "" {
+			v.recoveryCode("recovery_code", r.GetRecoveryCode())
+		} else {
+			v.totpCode("code", r.GetCode())
+		}
+	case *pb.RegenerateRecoveryCodesRequest:
+		v.totpCode("code", r.GetCode())
+	case *pb.ChangePasswordRequest:
+		v.password("current_password", r.GetCurrentPassword())
+		v.password("new_password", r.GetNewPassword())
+		v.password("new_password_re", r.GetNewPasswordRe())
+	}
+
+	return v.violations
+}
+
+// validator collects the violations of the rules shared by the request messages.
+type validator struct {
+	violations []grpc_errors.FieldViolation
+}
+
+func (v *validator) add(field string, format string, args ...any) {
+	v.violations = append(v.violations, grpc_errors.FieldViolation{Field: field, Description: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) required(field string, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		v.add(field, "must not be empty")
+		return false
+	}
+
+	return true
+}
+
+func (v *validator) maxLength(field string, value string, max int) bool {
+	if utf8.RuneCountInString(value) > max {
+		v.add(field, "must be at most %d characters", max)
+		return false
+	}
+
+	return true
+}
+
+func (v *validator) email(field string, value string) {
+	if !v.required(field, value) || !v.maxLength(field, value, maxEmailLength) {
+		return
+	}
+
+	address, err := mail.ParseAddress(value)
+	if err != nil || address.Address != value || address.Name != "" {
+		v.add(field, "must be a valid email address")
+	}
+}
+
+func (v *validator) username(field string, value string) {
+	if !v.required(field, value) {
+		return
+	}
+
+	length := utf8.RuneCountInString(value)
+	if length < minUsernameLength || length > maxUsernameLength {
+		v.add(field, "must be between %d and %d characters", minUsernameLength, maxUsernameLength)
+		return
+	}
+
+	if !usernamePattern.MatchString(value) {
+		v.add(field, "may only contain letters, digits, '_', '.' and '-'")
+	}
+}
+
+func (v *validator) password(field string, value string) {
+	if v.required(field, value) {
+		v.maxLength(field, value, maxPasswordLength)
+	}
+}
+
+func (v *validator) token(field string, value string) {
+	if v.required(field, value) {
+		v.maxLength(field, value, maxTokenLength)
+	}
+}
+
+func (v *validator) uuid(field string, value string) {
+	if !v.required(field, value) {
+		return
+	}
+
+	if _, err := uuid.Parse(value); err != nil || len(value) != 36 {
+		v.add(field, "must be a valid UUID")
+	}
+}
+
+// verificationCode checks an emailed code: a numeric otp when the user id is
+// given, a link code otherwise.
+func (v *validator) verificationCode(field string, value string, userID string) {
+	if userID == "" {
+		v.uuid(field, value)
+		return
+	}
+
+	v.uuid("user_id", userID)
+
+	if !v.required(field, value) {
+		return
+	}
+
+	if len(value) < minOTPLength || len(value) > maxOTPLength || !digitsPattern.MatchString(value) {
+		v.add(field, "must be %d to %d digits", minOTPLength, maxOTPLength)
+	}
+}
+
+func (v *validator) totpCode(field string, value string) {
+	if !v.required(field, value) {
+		return
+	}
+
+	if len(value) != totpCodeLength || !digitsPattern.MatchString(value) {
+		v.add(field, "must be %d digits", totpCodeLength)
+	}
+}
+
+func (v *validator) recoveryCode(field string, value string) {
+	if !recoveryCodePattern.MatchString(strings.TrimSpace(value)) {
+		v.add(field, "must be a valid recovery code")
+	}
+}
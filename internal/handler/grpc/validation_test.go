@@ -0,0 +1,124 @@
+package grpc
+
+import (
+	"context"
+	pb "github.com/Verce11o/yata-protos/gen/go/sso"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testUUID = "0b7e2d5e-3c4f-4a51-9a0e-2f6c1d8b9e10"
+
+func TestValidateRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		req  any
+		// fields of the expected violations, in order
+		want []string
+	}{
+		{name: "valid register", req: &pb.RegisterRequest{Username: "john.doe", Email: "john@example.com", Password: "secret"}},
+		{name: "empty register", req: &pb.RegisterRequest{}, want: []string{"username", "email", "password"}},
+		{name: "short username", req: &pb.RegisterRequest{Username: "jo", Email: "john@example.com", Password: "secret"}, want: []string{"username"}},
+		{name: "username with spaces", req: &pb.RegisterRequest{Username: "john doe", Email: "john@example.com", Password: "secret"}, want: []string{"username"}},
+		{name: "email with display name", req: &pb.RegisterRequest{Username: "john", Email: "John <john@example.com>", Password: "secret"}, want: []string{"email"}},
+		{name: "email without domain", req: &pb.LoginRequest{Email: "john", Password: "secret"}, want: []string{"email"}},
+		{name: "too long email", req: &pb.LoginRequest{Email: strings.Repeat("a", 250) + "@example.com", Password: "secret"}, want: []string{"email"}},
+		{name: "too long password", req: &pb.LoginRequest{Email: "john@example.com", Password: strings.Repeat("a", maxPasswordLength+1)}, want: []string{"password"}},
+		{name: "blank password", req: &pb.LoginRequest{Email: "john@example.com", Password: "   "}, want: []string{"password"}},
+		{name: "valid user id", req: &pb.VerifyRequest{UserId: testUUID}},
+		{name: "user id without dashes", req: &pb.GetUserRequest{UserId: strings.ReplaceAll(testUUID, "-", "")}, want: []string{"user_id"}},
+		{name: "link code", req: &pb.CheckVerifyRequest{Code: testUUID}},
+		{name: "malformed link code", req: &pb.CheckVerifyRequest{Code: "123456"}, want: []string{"code"}},
+		{name: "otp", req: &pb.CheckVerifyRequest{Code: "123456", UserId: testUUID}},
+		{name: "otp with letters", req: &pb.VerifyPasswordRequest{Code: "12a456", UserId: testUUID}, want: []string{"code"}},
+		{name: "otp too short", req: &pb.VerifyPasswordRequest{Code: "123", UserId: testUUID}, want: []string{"code"}},
+		{name: "otp with invalid user id", req: &pb.CheckVerifyRequest{Code: "123456", UserId: "1"}, want: []string{"user_id"}},
+		{name: "reset password", req: &pb.ResetPasswordRequest{ResetToken: "token", Password: "a", PasswordRe: "a"}},
+		{name: "empty reset password", req: &pb.ResetPasswordRequest{}, want: []string{"reset_token", "password", "password_re"}},
+		{name: "too long token", req: &pb.RefreshRequest{RefreshToken: strings.Repeat("a", maxTokenLength+1)}, want: []string{"refresh_token"}},
+		{name: "totp code", req: &pb.ConfirmTOTPRequest{Code: "123456"}},
+		{name: "short totp code", req: &pb.RegenerateRecoveryCodesRequest{Code: "12345"}, want: []string{"code"}},
+		{name: "mfa with totp code", req: &pb.VerifyMFARequest{MfaToken: "token", Code: "123456"}},
+		{name: "mfa with recovery code", req: &pb.VerifyMFARequest{MfaToken: "token", RecoveryCode: "abcd-efgh-ijkl-mnop"}},
+		{name: "mfa with undashed recovery code", req: &pb.VerifyMFARequest{MfaToken: "token", RecoveryCode: "ABCDEFGHIJKLMNOP"}},
+		{name: "mfa with invalid recovery code", req: &pb.VerifyMFARequest{MfaToken: "token", RecoveryCode: "abcd-efgh-ijkl-mno1"}, want: []string{"recovery_code"}},
+		{name: "empty mfa", req: &pb.VerifyMFARequest{}, want: []string{"mfa_token", "code"}},
+		{name: "change password", req: &pb.ChangePasswordRequest{}, want: []string{"current_password", "new_password", "new_password_re"}},
+		{name: "revoke session", req: &pb.RevokeSessionRequest{SessionId: "current"}, want: []string{"session_id"}},
+		{name: "unknown message", req: &pb.ValidateTokenResponse{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, v := range validateRequest(tt.req) {
+				got = append(got, v.Field)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateRequest() fields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidationInterceptor(t *testing.T) {
+	interceptor := ValidationInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/sso.Auth/Login"}
+
+	tests := []struct {
+		name       string
+		req        any
+		wantCalled bool
+		wantFields []string
+	}{
+		{name: "valid", req: &pb.LoginRequest{Email: "john@example.com", Password: "secret"}, wantCalled: true},
+		{name: "invalid", req: &pb.LoginRequest{Email: "john"}, wantFields: []string{"email", "password"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			handler := func(ctx context.Context, req any) (any, error) {
+				called = true
+				return nil, nil
+			}
+
+			_, err := interceptor(context.Background(), tt.req, info, handler)
+
+			if called != tt.wantCalled {
+				t.Fatalf("handler called = %v, want %v", called, tt.wantCalled)
+			}
+
+			if tt.wantCalled {
+				if err != nil {
+					t.Errorf("interceptor() error = %v", err)
+				}
+				return
+			}
+
+			st := status.Convert(err)
+			if st.Code() != codes.InvalidArgument || !strings.HasPrefix(st.Message(), "Login: ") {
+				t.Errorf("status = %v %q, want InvalidArgument prefixed with the method", st.Code(), st.Message())
+			}
+
+			var fields []string
+			for _, detail := range st.Details() {
+				if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+					for _, v := range badRequest.GetFieldViolations() {
+						fields = append(fields, v.GetField())
+					}
+				}
+			}
+
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("BadRequest fields = %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package http
+
+import (
+	"encoding/json"
+	"github.com/Verce11o/yata-auth/internal/lib/auth_jwt"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+type JWKSHandler struct {
+	log        *zap.SugaredLogger
+	jwtService *auth_jwt.JWTService
+}
+
+func NewJWKSHandler(log *zap.SugaredLogger, jwtService *auth_jwt.JWTService) *JWKSHandler {
+	return &JWKSHandler{log: log, jwtService: jwtService}
+}
+
+func (h *JWKSHandler) Routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/jwks.json", h.GetJWKS)
+	return mux
+}
+
+func (h *JWKSHandler) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	if err := json.NewEncoder(w).Encode(h.jwtService.JWKS()); err != nil {
+		h.log.Errorf("GetJWKS: %v", err.Error())
+	}
+}
@@ -1,58 +1,203 @@
 package auth_jwt
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
-	"fmt"
+	"encoding/base64"
+	"encoding/hex"
 	"github.com/Verce11o/yata-auth/config"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"strings"
 	"time"
 )
 
-type tokenClaims struct {
+type TokenClaims struct {
 	jwt.RegisteredClaims
-	UserID string `json:"user_id"`
+	UserID    string `json:"user_id"`
+	SessionID string `json:"sid,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	// TokenVersion must match the version of the user, bumping it revokes
+	// every token issued before.
+	TokenVersion int `json:"ver"`
 }
 
 type JWTService struct {
 	config config.JWTConfig
+	keys   *KeySet
 }
 
-func MakeJWTService(JWTConfig config.JWTConfig) JWTService {
-	return JWTService{config: JWTConfig}
+func MakeJWTService(JWTConfig config.JWTConfig) (*JWTService, error) {
+	j := &JWTService{config: JWTConfig}
+
+	if len(JWTConfig.Keys) > 0 {
+		keys, err := LoadKeySet(JWTConfig.Keys, JWTConfig.SigningKeyID)
+		if err != nil {
+			return nil, err
+		}
+		j.keys = keys
+	}
+
+	return j, nil
+}
+
+func (j JWTService) GenerateToken(userID string, sessionID string, tokenVersion int) (string, error) {
+	token, _, err := j.IssueToken(userID, sessionID, tokenVersion)
+	return token, err
 }
 
-func (j JWTService) GenerateToken(userID string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &tokenClaims{
+// IssueToken is GenerateToken that also returns the claims, so the caller can
+// keep the token ID for revocation.
+func (j JWTService) IssueToken(userID string, sessionID string, tokenVersion int) (string, *TokenClaims, error) {
+	now := time.Now()
+
+	claims := &TokenClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(j.config.TokenTTLHours) * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        uuid.NewString(),
+			Subject:   userID,
+			Issuer:    j.config.Issuer,
+			ExpiresAt: jwt.NewNumericDate(now.Add(j.AccessTokenTTL())),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
-		UserID: userID,
-	})
+		UserID:       userID,
+		SessionID:    sessionID,
+		Scope:        strings.Join(j.config.Scopes, " "),
+		TokenVersion: tokenVersion,
+	}
 
-	return token.SignedString([]byte(j.config.Secret))
+	if j.config.Audience != "" {
+		claims.Audience = jwt.ClaimStrings{j.config.Audience}
+	}
+
+	token, err := j.sign(claims, "")
+	if err != nil {
+		return "", nil, err
+	}
+
+	return token, claims, nil
 }
 
-func (j JWTService) ParseToken(token string) (string, error) {
-	parsedToken, err := jwt.ParseWithClaims(token, &tokenClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(j.config.Secret), nil
-	})
+// sign signs the claims with the active key, typ marks tokens that are not
+// access tokens so they cannot be used in place of one.
+func (j JWTService) sign(claims jwt.Claims, typ string) (string, error) {
+	var token *jwt.Token
+
+	if j.keys == nil {
+		token = jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	} else {
+		token = jwt.NewWithClaims(j.keys.signing.method, claims)
+		token.Header["kid"] = j.keys.signing.id
+	}
+
+	if typ != "" {
+		token.Header["typ"] = typ
+	}
+
+	if j.keys == nil {
+		return token.SignedString([]byte(j.config.Secret))
+	}
+
+	return token.SignedString(j.keys.signing.private)
+}
+
+// ParseToken verifies the token signature, expiry and, when configured, its
+// issuer and audience.
+func (j JWTService) ParseToken(token string) (*TokenClaims, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(j.validMethods()),
+		jwt.WithExpirationRequired(),
+	}
+
+	if j.config.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(j.config.Issuer))
+	}
+
+	if j.config.Audience != "" {
+		opts = append(opts, jwt.WithAudience(j.config.Audience))
+	}
+
+	parsedToken, err := jwt.ParseWithClaims(token, &TokenClaims{}, j.keyFunc, opts...)
 
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	if typ, _ := parsedToken.Header["typ"].(string); typ != "" && typ != "JWT" {
+		return nil, jwt.ErrTokenInvalidClaims
 	}
 
-	claims, ok := parsedToken.Claims.(*tokenClaims)
+	claims, ok := parsedToken.Claims.(*TokenClaims)
 	if !ok {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+
+	return claims, nil
+}
+
+// JWKS returns the public keys used to verify tokens, it is empty when tokens
+// are signed with the shared secret.
+func (j JWTService) JWKS() JSONWebKeySet {
+	if j.keys == nil {
+		return JSONWebKeySet{Keys: []JSONWebKey{}}
+	}
+	return j.keys.JWKS()
+}
+
+func (j JWTService) keyFunc(token *jwt.Token) (interface{}, error) {
+	if j.keys == nil {
+		return []byte(j.config.Secret), nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+
+	key, err := j.keys.lookup(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, jwt.ErrTokenSignatureInvalid
+	}
+
+	return key.public, nil
+}
+
+func (j JWTService) validMethods() []string {
+	if j.keys == nil {
+		return []string{jwt.SigningMethodHS256.Alg()}
+	}
+	return j.keys.methods()
+}
+
+// GenerateRefreshToken returns an opaque refresh token and the digest that
+// should be persisted instead of the token itself.
+func (j JWTService) GenerateRefreshToken() (string, string, error) {
+	token, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	return token, HashRefreshToken(token), nil
+}
+
+func GenerateOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
 
-	return claims.UserID, nil
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
 
-func (j JWTService) GenerateHashPassword(password string) string {
-	hash := sha256.New()
-	hash.Write([]byte(password))
+func HashRefreshToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+func (j JWTService) AccessTokenTTL() time.Duration {
+	return time.Duration(j.config.AccessTokenTTLMinutes) * time.Minute
+}
 
-	return fmt.Sprintf("%x", hash.Sum([]byte(j.config.Salt)))
+func (j JWTService) RefreshTokenTTL() time.Duration {
+	return time.Duration(j.config.RefreshTokenTTLHours) * time.Hour
 }
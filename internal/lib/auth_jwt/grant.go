@@ -0,0 +1,66 @@
+package auth_jwt
+
+import (
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"time"
+)
+
+const PasswordResetGrant = "password_reset"
+
+// GrantClaims authorize a single operation on behalf of a user, for example
+// resetting the password after the emailed code was verified.
+type GrantClaims struct {
+	jwt.RegisteredClaims
+	Purpose string `json:"purpose"`
+}
+
+func grantType(purpose string) string {
+	return purpose + "+jwt"
+}
+
+func (j JWTService) GenerateGrant(userID string, purpose string, ttl time.Duration) (string, error) {
+	now := time.Now()
+
+	claims := &GrantClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   userID,
+			Issuer:    j.config.Issuer,
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+		Purpose: purpose,
+	}
+
+	return j.sign(claims, grantType(purpose))
+}
+
+// ParseGrant verifies a grant issued for the purpose.
+func (j JWTService) ParseGrant(token string, purpose string) (*GrantClaims, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(j.validMethods()),
+		jwt.WithExpirationRequired(),
+	}
+
+	if j.config.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(j.config.Issuer))
+	}
+
+	parsedToken, err := jwt.ParseWithClaims(token, &GrantClaims{}, j.keyFunc, opts...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if typ, _ := parsedToken.Header["typ"].(string); typ != grantType(purpose) {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+
+	claims, ok := parsedToken.Claims.(*GrantClaims)
+	if !ok || claims.Purpose != purpose || claims.Subject == "" || claims.ID == "" {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,169 @@
+package auth_jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/Verce11o/yata-auth/config"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"os"
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+type signingKey struct {
+	id       string
+	method   jwt.SigningMethod
+	private  crypto.Signer
+	public   crypto.PublicKey
+	retiring bool
+}
+
+// KeySet holds the asymmetric keys used to sign and verify tokens. Only the
+// signing key issues new tokens, every other key (including retiring ones) is
+// kept so tokens signed before a rotation stay valid until they expire.
+type KeySet struct {
+	signing *signingKey
+	keys    map[string]*signingKey
+	order   []string
+}
+
+func LoadKeySet(cfg []config.JWTKeyConfig, signingKeyID string) (*KeySet, error) {
+	ks := &KeySet{keys: make(map[string]*signingKey, len(cfg))}
+
+	for _, keyCfg := range cfg {
+		key, err := loadKey(keyCfg)
+		if err != nil {
+			return nil, fmt.Errorf("load key %s: %w", keyCfg.ID, err)
+		}
+
+		if _, ok := ks.keys[key.id]; ok {
+			return nil, fmt.Errorf("duplicate key id: %s", key.id)
+		}
+
+		ks.keys[key.id] = key
+		ks.order = append(ks.order, key.id)
+
+		if ks.signing == nil && !key.retiring && (signingKeyID == "" || signingKeyID == key.id) {
+			ks.signing = key
+		}
+	}
+
+	if ks.signing == nil {
+		return nil, errors.New("no active signing key configured")
+	}
+
+	return ks, nil
+}
+
+func (k *KeySet) lookup(kid string) (*signingKey, error) {
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+func (k *KeySet) methods() []string {
+	methods := make([]string, 0, len(k.keys))
+	seen := make(map[string]bool)
+
+	for _, key := range k.keys {
+		if !seen[key.method.Alg()] {
+			seen[key.method.Alg()] = true
+			methods = append(methods, key.method.Alg())
+		}
+	}
+
+	return methods
+}
+
+func loadKey(cfg config.JWTKeyConfig) (*signingKey, error) {
+	data, err := os.ReadFile(cfg.PrivateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed any
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type: %s", block.Type)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{id: cfg.ID, retiring: cfg.Retiring}
+
+	switch private := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.method = jwt.SigningMethodRS256
+		key.private = private
+		key.public = &private.PublicKey
+	case ed25519.PrivateKey:
+		key.method = jwt.SigningMethodEdDSA
+		key.private = private
+		key.public = private.Public()
+	default:
+		return nil, fmt.Errorf("unsupported private key type: %T", parsed)
+	}
+
+	return key, nil
+}
+
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS returns the public part of every loaded key as a RFC 7517 key set.
+func (k *KeySet) JWKS() JSONWebKeySet {
+	set := JSONWebKeySet{Keys: make([]JSONWebKey, 0, len(k.order))}
+
+	for _, kid := range k.order {
+		key := k.keys[kid]
+		jwk := JSONWebKey{Kid: key.id, Use: "sig", Alg: key.method.Alg()}
+
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
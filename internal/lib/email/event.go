@@ -0,0 +1,149 @@
+package email
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Verce11o/yata-auth/internal/domain"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Wire formats of published emails. FormatCompat sends the versioned envelope
+// together with the fields of the legacy SendUserEmailRequest so consumers
+// reading the old shape keep working while they migrate.
+const (
+	FormatLegacy = "legacy"
+	FormatCompat = "compat"
+	FormatV1     = "v1"
+)
+
+const (
+	EventContentType  = "application/vnd.yata.email-event.v1+json"
+	LegacyContentType = "text/plain"
+)
+
+var ErrUnknownFormat = errors.New("unknown email format")
+
+// legacyTypes maps event types to the types of SendUserEmailRequest.
+var legacyTypes = map[string]string{
+	domain.EmailEventVerification:    "email",
+	domain.EmailEventPasswordReset:   "password",
+	domain.EmailEventAccountLocked:   "lockout",
+	domain.EmailEventNewLogin:        "new_login",
+	domain.EmailEventPasswordChanged: "password_changed",
+}
+
+// Message is an encoded email event.
+type Message struct {
+	ContentType   string
+	Type          string
+	SchemaVersion int
+	Body          []byte
+}
+
+type compatEvent struct {
+	domain.EmailEvent
+	domain.SendUserEmailRequest
+}
+
+func ValidateFormat(format string) error {
+	switch format {
+	case FormatLegacy, FormatCompat, FormatV1:
+		return nil
+	}
+
+	return fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+}
+
+// EncodeEvent encodes the event in the given wire format.
+func EncodeEvent(event domain.EmailEvent, format string) (Message, error) {
+	var (
+		body        []byte
+		err         error
+		contentType = EventContentType
+	)
+
+	switch format {
+	case FormatV1:
+		body, err = json.Marshal(event)
+	case FormatCompat:
+		body, err = json.Marshal(compatEvent{EmailEvent: event, SendUserEmailRequest: ToLegacy(event)})
+	case FormatLegacy:
+		contentType = LegacyContentType
+		body, err = json.Marshal(ToLegacy(event))
+	default:
+		return Message{}, ValidateFormat(format)
+	}
+
+	if err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		ContentType:   contentType,
+		Type:          event.EventType,
+		SchemaVersion: event.SchemaVersion,
+		Body:          body,
+	}, nil
+}
+
+// DecodeEvent decodes an outbox payload, upgrading payloads written in the
+// legacy SendUserEmailRequest shape.
+func DecodeEvent(payload []byte) (domain.EmailEvent, error) {
+	var event domain.EmailEvent
+
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return domain.EmailEvent{}, err
+	}
+
+	if event.SchemaVersion > 0 {
+		return event, nil
+	}
+
+	var legacy domain.SendUserEmailRequest
+
+	if err := json.Unmarshal(payload, &legacy); err != nil {
+		return domain.EmailEvent{}, err
+	}
+
+	return FromLegacy(legacy), nil
+}
+
+func ToLegacy(event domain.EmailEvent) domain.SendUserEmailRequest {
+	return domain.SendUserEmailRequest{
+		Type: legacyTypes[event.EventType],
+		To:   event.Recipient.Email,
+		Code: legacyCode(event),
+	}
+}
+
+// legacyCode returns the link of the email, or the OTP when there is no link.
+func legacyCode(event domain.EmailEvent) string {
+	if link := event.Variables[domain.EmailVariableLink]; link != "" {
+		return link
+	}
+
+	return event.Variables[domain.EmailVariableCode]
+}
+
+func FromLegacy(legacy domain.SendUserEmailRequest) domain.EmailEvent {
+	event := domain.EmailEvent{
+		EventID:       uuid.New(),
+		SchemaVersion: domain.EmailEventSchemaVersion,
+		OccurredAt:    time.Now(),
+		Recipient:     domain.EmailRecipient{Email: legacy.To},
+	}
+
+	for eventType, legacyType := range legacyTypes {
+		if legacyType == legacy.Type {
+			event.EventType = eventType
+		}
+	}
+
+	if legacy.Code != "" {
+		event.Variables = map[string]string{domain.EmailVariableLink: legacy.Code}
+	}
+
+	return event
+}
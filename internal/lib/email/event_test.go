@@ -0,0 +1,214 @@
+package email
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Verce11o/yata-auth/internal/domain"
+	"github.com/google/uuid"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testEvent(variables map[string]string) domain.EmailEvent {
+	return domain.EmailEvent{
+		EventID:       uuid.MustParse("5f0c3c9e-2a8b-4c1e-9f3a-6d2b7e8c1a40"),
+		EventType:     domain.EmailEventPasswordReset,
+		SchemaVersion: domain.EmailEventSchemaVersion,
+		OccurredAt:    time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		Recipient:     domain.EmailRecipient{Email: "john@example.com", Username: "john", Locale: "en"},
+		Variables:     variables,
+	}
+}
+
+func TestEncodeEvent(t *testing.T) {
+	event := testEvent(map[string]string{domain.EmailVariableLink: "https://yata.local/reset?code=abc"})
+
+	tests := []struct {
+		format      string
+		contentType string
+		// fields that must be present in the body with these values
+		fields map[string]interface{}
+		// fields that must be absent from the body
+		absent []string
+	}{
+		{
+			format:      FormatV1,
+			contentType: EventContentType,
+			fields:      map[string]interface{}{"event_type": domain.EmailEventPasswordReset, "schema_version": float64(1)},
+			absent:      []string{"type", "to", "code"},
+		},
+		{
+			format:      FormatCompat,
+			contentType: EventContentType,
+			fields: map[string]interface{}{
+				"event_type": domain.EmailEventPasswordReset, "schema_version": float64(1),
+				"type": "password", "to": "john@example.com", "code": "https://yata.local/reset?code=abc",
+			},
+		},
+		{
+			format:      FormatLegacy,
+			contentType: LegacyContentType,
+			fields:      map[string]interface{}{"type": "password", "to": "john@example.com", "code": "https://yata.local/reset?code=abc"},
+			absent:      []string{"event_type", "schema_version"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			msg, err := EncodeEvent(event, tt.format)
+			if err != nil {
+				t.Fatalf("EncodeEvent: %v", err)
+			}
+
+			if msg.ContentType != tt.contentType || msg.Type != event.EventType || msg.SchemaVersion != event.SchemaVersion {
+				t.Errorf("EncodeEvent() = %q, %q, %d, want %q, %q, %d",
+					msg.ContentType, msg.Type, msg.SchemaVersion, tt.contentType, event.EventType, event.SchemaVersion)
+			}
+
+			var body map[string]interface{}
+			if err := json.Unmarshal(msg.Body, &body); err != nil {
+				t.Fatalf("body is not json: %v", err)
+			}
+
+			for field, want := range tt.fields {
+				if got := body[field]; !reflect.DeepEqual(got, want) {
+					t.Errorf("%s = %v, want %v", field, got, want)
+				}
+			}
+
+			for _, field := range tt.absent {
+				if _, ok := body[field]; ok {
+					t.Errorf("%s is present, want absent", field)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeEventUnknownFormat(t *testing.T) {
+	if _, err := EncodeEvent(testEvent(nil), "v2"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("EncodeEvent() error = %v, want %v", err, ErrUnknownFormat)
+	}
+}
+
+func TestToLegacy(t *testing.T) {
+	tests := []struct {
+		name      string
+		eventType string
+		variables map[string]string
+		want      domain.SendUserEmailRequest
+	}{
+		{
+			name:      "link",
+			eventType: domain.EmailEventVerification,
+			variables: map[string]string{domain.EmailVariableLink: "https://yata.local/verify?code=abc"},
+			want:      domain.SendUserEmailRequest{Type: "email", To: "john@example.com", Code: "https://yata.local/verify?code=abc"},
+		},
+		{
+			name:      "otp",
+			eventType: domain.EmailEventVerification,
+			variables: map[string]string{domain.EmailVariableCode: "123456"},
+			want:      domain.SendUserEmailRequest{Type: "email", To: "john@example.com", Code: "123456"},
+		},
+		{
+			name:      "link wins over otp",
+			eventType: domain.EmailEventPasswordReset,
+			variables: map[string]string{domain.EmailVariableLink: "https://yata.local/reset", domain.EmailVariableCode: "123456"},
+			want:      domain.SendUserEmailRequest{Type: "password", To: "john@example.com", Code: "https://yata.local/reset"},
+		},
+		{
+			name:      "no variables",
+			eventType: domain.EmailEventAccountLocked,
+			want:      domain.SendUserEmailRequest{Type: "lockout", To: "john@example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := testEvent(tt.variables)
+			event.EventType = tt.eventType
+
+			if got := ToLegacy(event); got != tt.want {
+				t.Errorf("ToLegacy() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeEvent(t *testing.T) {
+	v1, err := json.Marshal(testEvent(map[string]string{domain.EmailVariableCode: "123456"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compat, err := EncodeEvent(testEvent(map[string]string{domain.EmailVariableCode: "123456"}), FormatCompat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		payload   []byte
+		eventType string
+		email     string
+		variables map[string]string
+		wantErr   bool
+	}{
+		{
+			name:      "v1",
+			payload:   v1,
+			eventType: domain.EmailEventPasswordReset,
+			email:     "john@example.com",
+			variables: map[string]string{domain.EmailVariableCode: "123456"},
+		},
+		{
+			name:      "compat",
+			payload:   compat.Body,
+			eventType: domain.EmailEventPasswordReset,
+			email:     "john@example.com",
+			variables: map[string]string{domain.EmailVariableCode: "123456"},
+		},
+		{
+			name:      "legacy",
+			payload:   []byte(`{"type":"email","to":"john@example.com","code":"https://yata.local/verify?code=abc"}`),
+			eventType: domain.EmailEventVerification,
+			email:     "john@example.com",
+			variables: map[string]string{domain.EmailVariableLink: "https://yata.local/verify?code=abc"},
+		},
+		{
+			name:      "legacy without code",
+			payload:   []byte(`{"type":"lockout","to":"john@example.com"}`),
+			eventType: domain.EmailEventAccountLocked,
+			email:     "john@example.com",
+		},
+		{
+			name:    "not json",
+			payload: []byte("john@example.com"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := DecodeEvent(tt.payload)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeEvent() error = %v, want error %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if event.EventType != tt.eventType || event.Recipient.Email != tt.email || !reflect.DeepEqual(event.Variables, tt.variables) {
+				t.Errorf("DecodeEvent() = %q, %q, %v, want %q, %q, %v",
+					event.EventType, event.Recipient.Email, event.Variables, tt.eventType, tt.email, tt.variables)
+			}
+
+			if event.SchemaVersion != domain.EmailEventSchemaVersion || event.EventID == uuid.Nil {
+				t.Errorf("DecodeEvent() schema version %d, event id %s, want an upgraded envelope", event.SchemaVersion, event.EventID)
+			}
+		})
+	}
+}
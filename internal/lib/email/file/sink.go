@@ -0,0 +1,55 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"github.com/Verce11o/yata-auth/config"
+	"github.com/Verce11o/yata-auth/internal/domain"
+	"github.com/Verce11o/yata-auth/internal/lib/email"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// EmailSink writes emails into a maildir, every message is written to tmp and
+// then moved to new so mail clients never see partial files.
+type EmailSink struct {
+	dir      string
+	from     string
+	renderer email.Renderer
+}
+
+func NewEmailSink(cfg config.EmailConfig, renderer email.Renderer) (*EmailSink, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(cfg.File.Dir, sub), 0o750); err != nil {
+			return nil, err
+		}
+	}
+
+	return &EmailSink{dir: cfg.File.Dir, from: cfg.From, renderer: renderer}, nil
+}
+
+func (s *EmailSink) Publish(ctx context.Context, event domain.EmailEvent) error {
+	rendered, err := s.renderer.Render(event)
+	if err != nil {
+		return err
+	}
+
+	message, err := email.BuildMIME(s.from, event, rendered)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d.%s.yata-auth", time.Now().UnixNano(), event.EventID.String())
+	tmpPath := filepath.Join(s.dir, "tmp", name)
+
+	if err := os.WriteFile(tmpPath, message, 0o640); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, filepath.Join(s.dir, "new", name))
+}
+
+func (s *EmailSink) Close() error {
+	return nil
+}
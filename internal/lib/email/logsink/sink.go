@@ -0,0 +1,39 @@
+package logsink
+
+import (
+	"context"
+	"github.com/Verce11o/yata-auth/internal/domain"
+	"github.com/Verce11o/yata-auth/internal/lib/email"
+	"go.uber.org/zap"
+)
+
+// EmailSink only logs emails, it is meant for local development.
+type EmailSink struct {
+	log      *zap.SugaredLogger
+	renderer email.Renderer
+}
+
+func NewEmailSink(log *zap.SugaredLogger, renderer email.Renderer) *EmailSink {
+	return &EmailSink{log: log, renderer: renderer}
+}
+
+func (s *EmailSink) Publish(ctx context.Context, event domain.EmailEvent) error {
+	rendered, err := s.renderer.Render(event)
+	if err != nil {
+		return err
+	}
+
+	s.log.Infow("email",
+		"event_id", event.EventID.String(),
+		"event_type", event.EventType,
+		"to", event.Recipient.Email,
+		"subject", rendered.Subject,
+		"body", rendered.Text,
+	)
+
+	return nil
+}
+
+func (s *EmailSink) Close() error {
+	return nil
+}
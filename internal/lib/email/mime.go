@@ -0,0 +1,79 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/Verce11o/yata-auth/internal/domain"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// BuildMIME encodes a rendered email as a multipart/alternative RFC 5322 message.
+func BuildMIME(from string, event domain.EmailEvent, rendered Rendered) ([]byte, error) {
+	var buf bytes.Buffer
+
+	body := multipart.NewWriter(&buf)
+
+	header := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMessage-ID: <%s@yata-auth>\r\nMIME-Version: 1.0\r\nContent-Type: multipart/alternative; boundary=%q\r\n\r\n",
+		headerValue(from),
+		headerValue(event.Recipient.Email),
+		mime.QEncoding.Encode("utf-8", rendered.Subject),
+		event.OccurredAt.Format(time.RFC1123Z),
+		event.EventID.String(),
+		body.Boundary(),
+	)
+
+	message := bytes.NewBufferString(header)
+
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", rendered.Text},
+		{"text/html; charset=utf-8", rendered.HTML},
+	}
+
+	for _, part := range parts {
+		if part.content == "" {
+			continue
+		}
+
+		w, err := body.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		qp := quotedprintable.NewWriter(w)
+
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+
+	message.Write(buf.Bytes())
+
+	return message.Bytes(), nil
+}
+
+var headerReplacer = strings.NewReplacer("\r", "", "\n", "")
+
+// headerValue prevents header injection through user supplied values.
+func headerValue(value string) string {
+	return headerReplacer.Replace(value)
+}
@@ -0,0 +1,138 @@
+package email
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestBuildMIME(t *testing.T) {
+	event := testEvent(nil)
+	rendered := Rendered{Subject: "Réinitialiser le mot de passe", Text: "Reset: https://yata.local/reset?code=abc", HTML: "<p>Reset: <a href=\"https://yata.local/reset?code=abc\">link</a></p>"}
+
+	message, err := BuildMIME("Yata <noreply@yata.local>", event, rendered)
+	if err != nil {
+		t.Fatalf("BuildMIME: %v", err)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(message)))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headers := map[string]string{
+		"From":       "Yata <noreply@yata.local>",
+		"To":         "john@example.com",
+		"Subject":    rendered.Subject,
+		"Message-ID": "<" + event.EventID.String() + "@yata-auth>",
+		"Date":       "Fri, 01 Mar 2024 12:00:00 +0000",
+	}
+
+	for name, want := range headers {
+		got := msg.Header.Get(name)
+		if name == "Subject" {
+			got = subject
+		}
+
+		if got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+
+	parts := readParts(t, msg)
+
+	want := map[string]string{
+		"text/plain; charset=utf-8": rendered.Text,
+		"text/html; charset=utf-8":  rendered.HTML,
+	}
+
+	if len(parts) != len(want) {
+		t.Fatalf("message has %d parts, want %d", len(parts), len(want))
+	}
+
+	for contentType, content := range want {
+		if parts[contentType] != content {
+			t.Errorf("%s part = %q, want %q", contentType, parts[contentType], content)
+		}
+	}
+}
+
+func TestBuildMIMEOmitsEmptyParts(t *testing.T) {
+	message, err := BuildMIME("noreply@yata.local", testEvent(nil), Rendered{Subject: "Reset", Text: "Reset"})
+	if err != nil {
+		t.Fatalf("BuildMIME: %v", err)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(message)))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+
+	parts := readParts(t, msg)
+
+	if _, ok := parts["text/html; charset=utf-8"]; ok || len(parts) != 1 {
+		t.Errorf("message parts = %v, want only the text part", parts)
+	}
+}
+
+func TestBuildMIMEHeaderInjection(t *testing.T) {
+	event := testEvent(nil)
+	event.Recipient.Email = "john@example.com\r\nBcc: eve@example.com"
+
+	message, err := BuildMIME("noreply@yata.local", event, Rendered{Subject: "Reset", Text: "Reset"})
+	if err != nil {
+		t.Fatalf("BuildMIME: %v", err)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(message)))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+
+	if bcc := msg.Header.Get("Bcc"); bcc != "" {
+		t.Errorf("injected Bcc header = %q", bcc)
+	}
+}
+
+// readParts decodes the parts of a multipart message keyed by content type.
+func readParts(t *testing.T, msg *mail.Message) map[string]string {
+	t.Helper()
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, want multipart/alternative", mediaType)
+	}
+
+	parts := make(map[string]string)
+
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return parts
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		content, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		parts[part.Header.Get("Content-Type")] = string(content)
+	}
+}
@@ -2,8 +2,15 @@ package email
 
 import (
 	"context"
+	"github.com/Verce11o/yata-auth/internal/domain"
 )
 
 type EmailPublisher interface {
-	Publish(ctx context.Context, message []byte) error
+	Publish(ctx context.Context, event domain.EmailEvent) error
+}
+
+// Transport is an EmailPublisher owning resources released on shutdown.
+type Transport interface {
+	EmailPublisher
+	Close() error
 }
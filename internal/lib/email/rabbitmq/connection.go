@@ -4,15 +4,13 @@ import (
 	"fmt"
 	"github.com/Verce11o/yata-auth/config"
 	amqp "github.com/rabbitmq/amqp091-go"
-	"log"
 )
 
-func NewAmqpConnection(cfg config.RabbitMQ) *amqp.Connection {
+func NewAmqpConnection(cfg config.RabbitMQ) (*amqp.Connection, error) {
 	conn, err := amqp.Dial(fmt.Sprintf("amqp://%s:%s@%s:%s/", cfg.Username, cfg.Password, cfg.Host, cfg.Port))
 	if err != nil {
-		log.Fatalf("err while connection to amqp: %v", err.Error())
+		return nil, fmt.Errorf("err while connection to amqp: %w", err)
 	}
 
-	return conn
-
+	return conn, nil
 }
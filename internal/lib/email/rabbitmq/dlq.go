@@ -0,0 +1,146 @@
+package rabbitmq
+
+import (
+	"context"
+	"github.com/Verce11o/yata-auth/config"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"time"
+)
+
+// DeadLetter is a message parked in the dead-letter queue.
+type DeadLetter struct {
+	MessageID string
+	Timestamp time.Time
+	Attempts  int
+	Reason    string
+	Body      []byte
+}
+
+// InspectDeadLetters returns up to limit messages from the dead-letter queue
+// without removing them.
+func InspectDeadLetters(conn *amqp.Connection, cfg config.RabbitMQ, limit int) ([]DeadLetter, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	// unacknowledged deliveries are requeued once the channel is closed
+	defer ch.Close()
+
+	var letters []DeadLetter
+
+	for len(letters) < limit {
+		d, ok, err := ch.Get(DeadLetterQueue(cfg), false)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			break
+		}
+
+		letters = append(letters, newDeadLetter(d))
+	}
+
+	return letters, nil
+}
+
+// ReplayDeadLetters moves up to limit messages from the dead-letter queue back
+// to the emails exchange with a reset attempt counter.
+func ReplayDeadLetters(ctx context.Context, conn *amqp.Connection, cfg config.RabbitMQ, limit int) (int, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return 0, err
+	}
+	defer ch.Close()
+
+	if err := ch.Confirm(false); err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+
+	for replayed < limit {
+		d, ok, err := ch.Get(DeadLetterQueue(cfg), false)
+		if err != nil {
+			return replayed, err
+		}
+
+		if !ok {
+			break
+		}
+
+		headers := amqp.Table{}
+		for k, v := range d.Headers {
+			if k != "x-death" && k != "x-first-death-exchange" && k != "x-first-death-queue" && k != "x-first-death-reason" {
+				headers[k] = v
+			}
+		}
+		headers[AttemptHeader] = int32(0)
+
+		confirm, err := ch.PublishWithDeferredConfirmWithContext(ctx, cfg.ExchangeName, cfg.BindingKey, false, false, amqp.Publishing{
+			ContentType:   d.ContentType,
+			DeliveryMode:  amqp.Persistent,
+			MessageId:     d.MessageId,
+			CorrelationId: d.CorrelationId,
+			Type:          d.Type,
+			Timestamp:     d.Timestamp,
+			Headers:       headers,
+			Body:          d.Body,
+		})
+
+		if err != nil {
+			_ = d.Nack(false, true)
+			return replayed, err
+		}
+
+		acked, err := confirm.WaitContext(ctx)
+		if err != nil || !acked {
+			_ = d.Nack(false, true)
+			if err == nil {
+				err = ErrNotConfirmed
+			}
+			return replayed, err
+		}
+
+		if err := d.Ack(false); err != nil {
+			return replayed, err
+		}
+
+		replayed++
+	}
+
+	return replayed, nil
+}
+
+func newDeadLetter(d amqp.Delivery) DeadLetter {
+	letter := DeadLetter{
+		MessageID: d.MessageId,
+		Timestamp: d.Timestamp,
+		Attempts:  MessageAttempts(d.Headers),
+		Body:      d.Body,
+	}
+
+	if deaths, ok := d.Headers["x-death"].([]interface{}); ok && len(deaths) > 0 {
+		if death, ok := deaths[0].(amqp.Table); ok {
+			letter.Reason, _ = death["reason"].(string)
+		}
+	}
+
+	return letter
+}
+
+// MessageAttempts reads the AttemptHeader of a delivery.
+func MessageAttempts(headers amqp.Table) int {
+	switch v := headers[AttemptHeader].(type) {
+	case int:
+		return v
+	case int16:
+		return int(v)
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	}
+
+	return 0
+}
@@ -0,0 +1,59 @@
+package rabbitmq
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Verce11o/yata-auth/config"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const policyRequestTimeout = 10 * time.Second
+
+// ApplyDeadLetterPolicy sets the policy returned by DeadLetterPolicy on the
+// default vhost through the management API. Setting it again is a no-op, so
+// it runs on every start.
+func ApplyDeadLetterPolicy(ctx context.Context, cfg config.RabbitMQ) error {
+	name, pattern, definition, err := DeadLetterPolicy(cfg)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"pattern":    pattern,
+		"definition": json.RawMessage(definition),
+		"apply-to":   "queues",
+		"priority":   0,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, policyRequestTimeout)
+	defer cancel()
+
+	endpoint := fmt.Sprintf("http://%s:%s/api/policies/%s/%s", cfg.Host, cfg.ManagementPort, url.PathEscape("/"), url.PathEscape(name))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.SetBasicAuth(cfg.Username, cfg.Password)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("err while setting dead letter policy: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("err while setting dead letter policy: management api returned %s", resp.Status)
+	}
+
+	return nil
+}
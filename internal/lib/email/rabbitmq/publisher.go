@@ -2,97 +2,356 @@ package rabbitmq
 
 import (
 	"context"
+	"errors"
 	"github.com/Verce11o/yata-auth/config"
-	"github.com/google/uuid"
+	"github.com/Verce11o/yata-auth/internal/domain"
+	"github.com/Verce11o/yata-auth/internal/lib/email"
 	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"sync"
 	"time"
 )
 
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 30 * time.Second
+)
+
+var (
+	ErrNotConfirmed    = errors.New("message was not confirmed by the broker")
+	ErrNotConnected    = errors.New("amqp connection is not available")
+	ErrPublisherClosed = errors.New("email publisher is closed")
+)
+
+// EmailPublisher publishes emails over a bounded pool of confirm mode
+// channels and reconnects with back-off when the broker connection is lost.
 type EmailPublisher struct {
-	AmqpConn *amqp.Connection
-	log      *zap.SugaredLogger
-	trace    trace.Tracer
-	cfg      config.RabbitMQ
-}
+	log   *zap.SugaredLogger
+	trace trace.Tracer
+	cfg   config.RabbitMQ
+
+	mu   sync.RWMutex
+	conn *amqp.Connection
+
+	slots chan struct{}
+	idle  chan *amqp.Channel
 
-func NewEmailPublisher(amqpConn *amqp.Connection, log *zap.SugaredLogger, trace trace.Tracer, cfg config.RabbitMQ) *EmailPublisher {
-	return &EmailPublisher{AmqpConn: amqpConn, log: log, trace: trace, cfg: cfg}
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
-func (c *EmailPublisher) createChannel(exchangeName string, queueName string, bindingKey string) *amqp.Channel {
+func NewEmailPublisher(log *zap.SugaredLogger, trace trace.Tracer, cfg config.RabbitMQ) (*EmailPublisher, error) {
+	if err := email.ValidateFormat(cfg.EmailFormat); err != nil {
+		return nil, err
+	}
 
-	ch, err := c.AmqpConn.Channel()
+	poolSize := cfg.ChannelPoolSize
+	if poolSize < 1 {
+		poolSize = 1
+	}
 
-	if err != nil {
-		panic(err)
+	p := &EmailPublisher{
+		log:   log,
+		trace: trace,
+		cfg:   cfg,
+		slots: make(chan struct{}, poolSize),
+		idle:  make(chan *amqp.Channel, poolSize),
+		done:  make(chan struct{}),
 	}
 
-	err = ch.ExchangeDeclare(
-		exchangeName,
-		"direct",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
+	if err := ApplyDeadLetterPolicy(context.Background(), cfg); err != nil {
+		return nil, err
+	}
 
+	conn, err := p.connect()
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	queue, err := ch.QueueDeclare(
-		queueName,
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
+	p.conn = conn
 
-	if err != nil {
-		panic(err)
+	go p.watchConnection(conn)
+
+	return p, nil
+}
+
+func (p *EmailPublisher) Publish(ctx context.Context, event domain.EmailEvent) error {
+	ctx, span := p.trace.Start(ctx, p.cfg.ExchangeName+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystem("rabbitmq"),
+			semconv.MessagingOperationPublish,
+			semconv.MessagingDestinationName(p.cfg.ExchangeName),
+			semconv.MessagingRabbitmqDestinationRoutingKey(p.cfg.BindingKey),
+			semconv.MessagingMessageID(event.EventID.String()),
+			semconv.ServerAddress(p.cfg.Host),
+		))
+	defer span.End()
+
+	if event.CorrelationID != "" {
+		span.SetAttributes(semconv.MessagingMessageConversationID(event.CorrelationID))
 	}
 
-	err = ch.QueueBind(
-		queue.Name,
-		bindingKey,
-		exchangeName,
-		false,
-		nil,
-	)
+	if err := p.publish(ctx, event); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
 
+	return nil
+}
+
+func (p *EmailPublisher) publish(ctx context.Context, event domain.EmailEvent) error {
+	message, err := email.EncodeEvent(event, p.cfg.EmailFormat)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	return ch
+	trace.SpanFromContext(ctx).SetAttributes(semconv.MessagingMessagePayloadSizeBytes(len(message.Body)))
 
-}
+	headers := amqp.Table{
+		AttemptHeader:       int32(0),
+		SchemaVersionHeader: int32(message.SchemaVersion),
+	}
 
-func (c *EmailPublisher) Publish(ctx context.Context, message []byte) error {
+	InjectTraceContext(ctx, headers)
 
-	ch := c.createChannel(c.cfg.ExchangeName, c.cfg.QueueName, c.cfg.BindingKey)
+	if p.cfg.ConfirmTimeoutSeconds > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(p.cfg.ConfirmTimeoutSeconds)*time.Second)
+		defer cancel()
+	}
 
-	if err := ch.PublishWithContext(
+	ch, err := p.acquireChannel(ctx)
+	if err != nil {
+		return err
+	}
+
+	confirmation, err := ch.PublishWithDeferredConfirmWithContext(
 		ctx,
-		c.cfg.ExchangeName,
-		c.cfg.BindingKey,
+		p.cfg.ExchangeName,
+		p.cfg.BindingKey,
 		false,
 		false,
 		amqp.Publishing{
-			ContentType:  "text/plain",
-			DeliveryMode: amqp.Persistent,
-			MessageId:    uuid.New().String(),
-			Timestamp:    time.Now(),
-			Body:         message,
-		}); err != nil {
+			ContentType:   message.ContentType,
+			DeliveryMode:  amqp.Persistent,
+			MessageId:     event.EventID.String(),
+			CorrelationId: event.CorrelationID,
+			Type:          message.Type,
+			Timestamp:     event.OccurredAt,
+			Headers:       headers,
+			Body:          message.Body,
+		})
+
+	if err != nil {
+		p.releaseChannel(ch)
+		return err
+	}
 
+	acked, err := confirmation.WaitContext(ctx)
+
+	p.releaseChannel(ch)
+
+	if err != nil {
 		return err
 	}
 
+	if !acked {
+		return ErrNotConfirmed
+	}
+
 	return nil
+}
+
+// Close stops reconnecting and closes the pooled channels and the connection.
+func (p *EmailPublisher) Close() error {
+	var err error
+
+	p.closeOnce.Do(func() {
+		close(p.done)
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		p.drainIdle()
+
+		if p.conn != nil {
+			err = p.conn.Close()
+		}
+	})
+
+	return err
+}
 
+// acquireChannel takes a pool slot and returns an idle channel or opens a new one.
+func (p *EmailPublisher) acquireChannel(ctx context.Context) (*amqp.Channel, error) {
+	select {
+	case <-p.done:
+		return nil, ErrPublisherClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case p.slots <- struct{}{}:
+	}
+
+	if ch := p.takeIdle(); ch != nil {
+		return ch, nil
+	}
+
+	ch, err := p.openChannel()
+	if err != nil {
+		<-p.slots
+		return nil, err
+	}
+
+	return ch, nil
+}
+
+// takeIdle returns an open idle channel, dropping the ones closed since they were pooled.
+func (p *EmailPublisher) takeIdle() *amqp.Channel {
+	for {
+		select {
+		case ch := <-p.idle:
+			if !ch.IsClosed() {
+				return ch
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+func (p *EmailPublisher) releaseChannel(ch *amqp.Channel) {
+	defer func() { <-p.slots }()
+
+	if ch.IsClosed() {
+		return
+	}
+
+	select {
+	case p.idle <- ch:
+	default:
+		_ = ch.Close()
+	}
+}
+
+func (p *EmailPublisher) openChannel() (*amqp.Channel, error) {
+	p.mu.RLock()
+	conn := p.conn
+	p.mu.RUnlock()
+
+	if conn == nil || conn.IsClosed() {
+		return nil, ErrNotConnected
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ch.Confirm(false); err != nil {
+		_ = ch.Close()
+		return nil, err
+	}
+
+	return ch, nil
+}
+
+func (p *EmailPublisher) connect() (*amqp.Connection, error) {
+	conn, err := NewAmqpConnection(p.cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := declareTopology(conn, p.cfg); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// watchConnection waits for the connection to close and reconnects with
+// exponential back-off until it succeeds or the publisher is closed.
+func (p *EmailPublisher) watchConnection(conn *amqp.Connection) {
+	for {
+		closed := conn.NotifyClose(make(chan *amqp.Error, 1))
+
+		// a connection that died before the listener was registered never
+		// reports an error, NotifyClose just closes the channel
+		if !conn.IsClosed() {
+			select {
+			case <-p.done:
+				return
+			case amqpErr := <-closed:
+				if amqpErr != nil {
+					p.log.Errorf("amqp connection closed: %v", amqpErr.Error())
+				}
+			}
+		}
+
+		// only Close shuts the connection down on purpose, and it closes done first
+		select {
+		case <-p.done:
+			return
+		default:
+		}
+
+		p.log.Info("amqp connection lost, reconnecting")
+
+		p.mu.Lock()
+		p.conn = nil
+		p.drainIdle()
+		p.mu.Unlock()
+
+		var err error
+		conn, err = p.reconnect()
+		if err != nil {
+			return
+		}
+
+		p.mu.Lock()
+		p.conn = conn
+		p.mu.Unlock()
+
+		p.log.Info("amqp connection restored")
+	}
+}
+
+func (p *EmailPublisher) reconnect() (*amqp.Connection, error) {
+	delay := minReconnectDelay
+
+	for {
+		select {
+		case <-p.done:
+			return nil, ErrPublisherClosed
+		case <-time.After(delay):
+		}
+
+		conn, err := p.connect()
+		if err == nil {
+			return conn, nil
+		}
+
+		p.log.Errorf("cannot reconnect to amqp, retrying in %s: %v", delay, err.Error())
+
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+func (p *EmailPublisher) drainIdle() {
+	for {
+		select {
+		case ch := <-p.idle:
+			_ = ch.Close()
+		default:
+			return
+		}
+	}
 }
@@ -0,0 +1,141 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Verce11o/yata-auth/config"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"regexp"
+	"time"
+)
+
+const (
+	// AttemptHeader holds the number of times delivery of a message has been retried.
+	AttemptHeader = "x-attempt"
+	// SchemaVersionHeader holds the schema version of the email event.
+	SchemaVersionHeader = "x-schema-version"
+)
+
+// The emails topology:
+//
+//	exchange --bindingKey--> queue --(rejected)--> exchange.dlx --> queue.dlq
+//	exchange.retry --bindingKey.retry.N--> queue.retry.N --(ttl)--> exchange --> queue
+//
+// The consumer republishes failed messages to exchange.retry with the routing
+// key of the next attempt and an incremented AttemptHeader, once the retries
+// are exhausted it rejects the message so it ends up in the dead-letter queue.
+//
+// The main queue is declared without arguments so deployments that created it
+// before dead-lettering was introduced keep working, its dead-letter exchange is
+// applied through the policy returned by DeadLetterPolicy instead. The
+// publisher sets the policy through the management API before it connects.
+
+func DeadLetterExchange(cfg config.RabbitMQ) string {
+	return cfg.ExchangeName + ".dlx"
+}
+
+func DeadLetterQueue(cfg config.RabbitMQ) string {
+	return cfg.QueueName + ".dlq"
+}
+
+// DeadLetterPolicy returns the name, queue pattern and definition of the broker
+// policy that dead-letters messages rejected from the main queue.
+func DeadLetterPolicy(cfg config.RabbitMQ) (string, string, string, error) {
+	definition, err := json.Marshal(map[string]string{
+		"dead-letter-exchange":    DeadLetterExchange(cfg),
+		"dead-letter-routing-key": cfg.BindingKey,
+	})
+
+	if err != nil {
+		return "", "", "", err
+	}
+
+	return cfg.QueueName + "-dead-letter", "^" + regexp.QuoteMeta(cfg.QueueName) + "$", string(definition), nil
+}
+
+func RetryExchange(cfg config.RabbitMQ) string {
+	return cfg.ExchangeName + ".retry"
+}
+
+func RetryQueue(cfg config.RabbitMQ, attempt int) string {
+	return fmt.Sprintf("%s.retry.%d", cfg.QueueName, attempt)
+}
+
+func RetryRoutingKey(cfg config.RabbitMQ, attempt int) string {
+	return fmt.Sprintf("%s.retry.%d", cfg.BindingKey, attempt)
+}
+
+func declareTopology(conn *amqp.Connection, cfg config.RabbitMQ) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	for _, exchange := range []string{cfg.ExchangeName, DeadLetterExchange(cfg), RetryExchange(cfg)} {
+		err = ch.ExchangeDeclare(
+			exchange,
+			"direct",
+			true,
+			false,
+			false,
+			false,
+			nil,
+		)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	err = declareQueue(ch, DeadLetterQueue(cfg), DeadLetterExchange(cfg), cfg.BindingKey, nil)
+
+	if err != nil {
+		return err
+	}
+
+	err = declareQueue(ch, cfg.QueueName, cfg.ExchangeName, cfg.BindingKey, nil)
+
+	if err != nil {
+		return err
+	}
+
+	for i, delay := range cfg.RetryDelaysSeconds {
+		attempt := i + 1
+
+		err = declareQueue(ch, RetryQueue(cfg, attempt), RetryExchange(cfg), RetryRoutingKey(cfg, attempt), amqp.Table{
+			"x-message-ttl":             (time.Duration(delay) * time.Second).Milliseconds(),
+			"x-dead-letter-exchange":    cfg.ExchangeName,
+			"x-dead-letter-routing-key": cfg.BindingKey,
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func declareQueue(ch *amqp.Channel, name string, exchange string, bindingKey string, args amqp.Table) error {
+	queue, err := ch.QueueDeclare(
+		name,
+		true,
+		false,
+		false,
+		false,
+		args,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return ch.QueueBind(
+		queue.Name,
+		bindingKey,
+		exchange,
+		false,
+		nil,
+	)
+}
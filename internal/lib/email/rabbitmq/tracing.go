@@ -0,0 +1,53 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+var propagator = propagation.TraceContext{}
+
+// headerCarrier adapts AMQP headers to a propagation.TextMapCarrier.
+type headerCarrier amqp.Table
+
+func (c headerCarrier) Get(key string) string {
+	switch v := c[key].(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (c headerCarrier) Set(key string, value string) {
+	c[key] = value
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// InjectTraceContext writes the W3C trace context of ctx into the headers.
+func InjectTraceContext(ctx context.Context, headers amqp.Table) {
+	propagator.Inject(ctx, headerCarrier(headers))
+}
+
+// ExtractTraceContext returns ctx with the W3C trace context read from the
+// headers of a delivery, consumers use it as the parent of their process span.
+func ExtractTraceContext(ctx context.Context, headers amqp.Table) context.Context {
+	if headers == nil {
+		return ctx
+	}
+
+	return propagator.Extract(ctx, headerCarrier(headers))
+}
@@ -0,0 +1,25 @@
+package email
+
+import (
+	"github.com/Verce11o/yata-auth/internal/domain"
+)
+
+const (
+	TransportRabbitMQ = "rabbitmq"
+	TransportSMTP     = "smtp"
+	TransportFile     = "file"
+	TransportLog      = "log"
+)
+
+// Rendered is an email ready to be delivered by a transport.
+type Rendered struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Renderer renders the body of an email event. Transports delivering emails
+// themselves use it, the RabbitMQ transport leaves rendering to the consumer.
+type Renderer interface {
+	Render(event domain.EmailEvent) (Rendered, error)
+}
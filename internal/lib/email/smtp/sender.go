@@ -0,0 +1,117 @@
+package smtp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"github.com/Verce11o/yata-auth/config"
+	"github.com/Verce11o/yata-auth/internal/domain"
+	"github.com/Verce11o/yata-auth/internal/lib/email"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"net"
+	netsmtp "net/smtp"
+	"time"
+)
+
+var ErrStartTLSUnsupported = errors.New("smtp server does not support STARTTLS")
+
+// EmailSender delivers emails directly to an SMTP relay.
+type EmailSender struct {
+	log      *zap.SugaredLogger
+	trace    trace.Tracer
+	cfg      config.SMTPConfig
+	from     string
+	renderer email.Renderer
+}
+
+func NewEmailSender(log *zap.SugaredLogger, trace trace.Tracer, cfg config.EmailConfig, renderer email.Renderer) *EmailSender {
+	return &EmailSender{log: log, trace: trace, cfg: cfg.SMTP, from: cfg.From, renderer: renderer}
+}
+
+func (s *EmailSender) Publish(ctx context.Context, event domain.EmailEvent) error {
+	ctx, span := s.trace.Start(ctx, "smtpSender.Publish", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
+	rendered, err := s.renderer.Render(event)
+	if err != nil {
+		return err
+	}
+
+	message, err := email.BuildMIME(s.from, event, rendered)
+	if err != nil {
+		return err
+	}
+
+	return s.send(ctx, event.Recipient.Email, message)
+}
+
+func (s *EmailSender) Close() error {
+	return nil
+}
+
+func (s *EmailSender) send(ctx context.Context, to string, message []byte) error {
+	timeout := time.Duration(s.cfg.TimeoutSeconds) * time.Second
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	dialer := net.Dialer{}
+
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(s.cfg.Host, s.cfg.Port))
+	if err != nil {
+		return err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := netsmtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if s.cfg.StartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return ErrStartTLSUnsupported
+		}
+
+		if err := client.StartTLS(&tls.Config{ServerName: s.cfg.Host, MinVersion: tls.VersionTLS12}); err != nil {
+			return err
+		}
+	}
+
+	if s.cfg.Username != "" {
+		if err := client.Auth(netsmtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(s.from); err != nil {
+		return err
+	}
+
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
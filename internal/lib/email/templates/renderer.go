@@ -0,0 +1,236 @@
+package templates
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"github.com/Verce11o/yata-auth/internal/domain"
+	"github.com/Verce11o/yata-auth/internal/lib/email"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+//go:embed files
+var files embed.FS
+
+// fallbackLocale is the last entry of every locale chain, all templates exist in it.
+const fallbackLocale = "en"
+
+const layoutFile = "files/layout.html.tmpl"
+
+var ErrUnknownTemplate = errors.New("no template for email event")
+
+// names maps event types to template file names.
+var names = map[string]string{
+	domain.EmailEventVerification:    "verification",
+	domain.EmailEventPasswordReset:   "password_reset",
+	domain.EmailEventAccountLocked:   "account_locked",
+	domain.EmailEventNewLogin:        "new_login",
+	domain.EmailEventPasswordChanged: "password_changed",
+}
+
+type emailTemplate struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+// Data is available to every template.
+type Data struct {
+	Subject   string
+	Locale    string
+	Username  string
+	Email     string
+	Link      string
+	Code      string
+	ExpiresAt *time.Time
+	Variables map[string]string
+}
+
+// Renderer renders email events with the embedded html/template and
+// text/template files, choosing the locale of the recipient.
+type Renderer struct {
+	defaultLocale string
+	// templates by locale and event type
+	templates map[string]map[string]emailTemplate
+}
+
+func NewRenderer(defaultLocale string) (*Renderer, error) {
+	localeDirs, err := fs.ReadDir(files, "files")
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Renderer{
+		defaultLocale: normalizeLocale(defaultLocale),
+		templates:     make(map[string]map[string]emailTemplate),
+	}
+
+	for _, dir := range localeDirs {
+		if !dir.IsDir() {
+			continue
+		}
+
+		locale := dir.Name()
+		r.templates[locale] = make(map[string]emailTemplate)
+
+		for eventType, name := range names {
+			tmpl, err := parseTemplate(locale, name)
+
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+
+			if err != nil {
+				return nil, fmt.Errorf("parse %s/%s: %w", locale, name, err)
+			}
+
+			r.templates[locale][eventType] = tmpl
+		}
+	}
+
+	for eventType, name := range names {
+		if _, ok := r.templates[fallbackLocale][eventType]; !ok {
+			return nil, fmt.Errorf("%w: %s is missing in %s", ErrUnknownTemplate, name, fallbackLocale)
+		}
+	}
+
+	return r, nil
+}
+
+func parseTemplate(locale string, name string) (emailTemplate, error) {
+	base := path.Join("files", locale, name)
+
+	subject, err := texttemplate.New(name).Option("missingkey=zero").ParseFS(files, base+".subject.tmpl")
+	if err != nil {
+		return emailTemplate{}, err
+	}
+
+	text, err := texttemplate.New(name).Option("missingkey=zero").ParseFS(files, base+".txt.tmpl")
+	if err != nil {
+		return emailTemplate{}, err
+	}
+
+	html, err := htmltemplate.New(name).Option("missingkey=zero").ParseFS(files, layoutFile, base+".html.tmpl")
+	if err != nil {
+		return emailTemplate{}, err
+	}
+
+	return emailTemplate{subject: subject.Lookup(name + ".subject.tmpl"), text: text.Lookup(name + ".txt.tmpl"), html: html}, nil
+}
+
+// Locales lists the locales templates exist for.
+func (r *Renderer) Locales() []string {
+	locales := make([]string, 0, len(r.templates))
+	for locale := range r.templates {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+func (r *Renderer) Render(event domain.EmailEvent) (email.Rendered, error) {
+	locale, tmpl, ok := r.lookup(event.EventType, event.Recipient.Locale)
+	if !ok {
+		return email.Rendered{}, fmt.Errorf("%w: %s", ErrUnknownTemplate, event.EventType)
+	}
+
+	data := Data{
+		Locale:    locale,
+		Username:  event.Recipient.Username,
+		Email:     event.Recipient.Email,
+		Link:      event.Variables[domain.EmailVariableLink],
+		Code:      event.Variables[domain.EmailVariableCode],
+		ExpiresAt: event.ExpiresAt,
+		Variables: event.Variables,
+	}
+
+	var subject, text, html bytes.Buffer
+
+	if err := tmpl.subject.Execute(&subject, data); err != nil {
+		return email.Rendered{}, err
+	}
+
+	data.Subject = strings.TrimSpace(subject.String())
+
+	if err := tmpl.text.Execute(&text, data); err != nil {
+		return email.Rendered{}, err
+	}
+
+	if err := tmpl.html.ExecuteTemplate(&html, "layout", data); err != nil {
+		return email.Rendered{}, err
+	}
+
+	return email.Rendered{Subject: data.Subject, Text: text.String(), HTML: html.String()}, nil
+}
+
+// lookup walks the locale chain of the recipient and returns the first template found.
+func (r *Renderer) lookup(eventType string, locale string) (string, emailTemplate, bool) {
+	for _, candidate := range LocaleChain(locale, r.defaultLocale) {
+		if tmpl, ok := r.templates[candidate][eventType]; ok {
+			return candidate, tmpl, true
+		}
+	}
+
+	return "", emailTemplate{}, false
+}
+
+// LocaleChain returns the locales tried for a recipient, e.g. pt-BR falls back
+// to pt, then to the default locale and finally to en.
+func LocaleChain(locale string, defaultLocale string) []string {
+	var chain []string
+
+	add := func(candidate string) {
+		if candidate == "" {
+			return
+		}
+		for _, existing := range chain {
+			if existing == candidate {
+				return
+			}
+		}
+		chain = append(chain, candidate)
+	}
+
+	for _, l := range []string{normalizeLocale(locale), normalizeLocale(defaultLocale)} {
+		add(l)
+		if i := strings.IndexByte(l, '-'); i > 0 {
+			add(l[:i])
+		}
+	}
+
+	add(fallbackLocale)
+
+	return chain
+}
+
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+// EventType returns the event type rendered by the named template.
+func EventType(name string) (string, bool) {
+	for eventType, n := range names {
+		if n == name {
+			return eventType, true
+		}
+	}
+
+	return "", false
+}
+
+// Names lists the template names.
+func Names() []string {
+	list := make([]string, 0, len(names))
+	for _, name := range names {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
@@ -0,0 +1,105 @@
+package templates
+
+import (
+	"errors"
+	"github.com/Verce11o/yata-auth/internal/domain"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLocaleChain(t *testing.T) {
+	tests := []struct {
+		locale        string
+		defaultLocale string
+		want          []string
+	}{
+		{locale: "ru", defaultLocale: "en", want: []string{"ru", "en"}},
+		{locale: "pt-BR", defaultLocale: "en", want: []string{"pt-br", "pt", "en"}},
+		{locale: "pt_BR", defaultLocale: "de-AT", want: []string{"pt-br", "pt", "de-at", "de", "en"}},
+		{locale: " RU ", defaultLocale: "ru", want: []string{"ru", "en"}},
+		{locale: "", defaultLocale: "ru", want: []string{"ru", "en"}},
+		{locale: "", defaultLocale: "", want: []string{"en"}},
+		{locale: "en-GB", defaultLocale: "en", want: []string{"en-gb", "en"}},
+		{locale: "-x", defaultLocale: "en", want: []string{"-x", "en"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.locale+"/"+tt.defaultLocale, func(t *testing.T) {
+			if got := LocaleChain(tt.locale, tt.defaultLocale); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LocaleChain(%q, %q) = %v, want %v", tt.locale, tt.defaultLocale, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderLocale(t *testing.T) {
+	tests := []struct {
+		name          string
+		defaultLocale string
+		locale        string
+		subject       string
+	}{
+		{name: "recipient locale", defaultLocale: "en", locale: "ru", subject: "Подтвердите почту"},
+		{name: "region falls back to language", defaultLocale: "en", locale: "ru-RU", subject: "Подтвердите почту"},
+		{name: "unknown locale falls back to default", defaultLocale: "ru", locale: "de", subject: "Подтвердите почту"},
+		{name: "unknown default falls back to en", defaultLocale: "de", locale: "fr", subject: "Confirm your email"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRenderer(tt.defaultLocale)
+			if err != nil {
+				t.Fatalf("NewRenderer: %v", err)
+			}
+
+			rendered, err := r.Render(domain.EmailEvent{
+				EventType: domain.EmailEventVerification,
+				Recipient: domain.EmailRecipient{Email: "john@example.com", Username: "john", Locale: tt.locale},
+				Variables: map[string]string{domain.EmailVariableCode: "123456"},
+			})
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+
+			if rendered.Subject != tt.subject {
+				t.Errorf("subject = %q, want %q", rendered.Subject, tt.subject)
+			}
+
+			if !strings.Contains(rendered.Text, "123456") || !strings.Contains(rendered.HTML, "123456") {
+				t.Errorf("rendered email does not contain the code")
+			}
+		})
+	}
+}
+
+func TestRenderUnknownEvent(t *testing.T) {
+	r, err := NewRenderer("en")
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+
+	if _, err := r.Render(domain.EmailEvent{EventType: "user.unknown"}); !errors.Is(err, ErrUnknownTemplate) {
+		t.Errorf("Render() error = %v, want %v", err, ErrUnknownTemplate)
+	}
+}
+
+func TestRenderEscapesHTML(t *testing.T) {
+	r, err := NewRenderer("en")
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+
+	rendered, err := r.Render(domain.EmailEvent{
+		EventType: domain.EmailEventVerification,
+		Recipient: domain.EmailRecipient{Email: "john@example.com", Username: "<script>alert(1)</script>"},
+		Variables: map[string]string{domain.EmailVariableLink: "https://yata.local/verify?code=abc"},
+	})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+
+	if strings.Contains(rendered.HTML, "<script>") || !strings.Contains(rendered.HTML, "&lt;script&gt;") {
+		t.Errorf("html body does not contain the escaped username")
+	}
+}
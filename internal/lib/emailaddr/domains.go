@@ -0,0 +1,271 @@
+package emailaddr
+
+import (
+	"bufio"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"github.com/Verce11o/yata-auth/config"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+	"golang.org/x/net/idna"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reasons reported by DomainFilter.Check and used as the metric attribute.
+const (
+	RejectNotAllowed = "not_allowed"
+	RejectDenied     = "denied"
+	RejectDisposable = "disposable"
+	RejectNoMX       = "no_mx"
+)
+
+//go:embed lists/disposable_domains.txt
+var lists embed.FS
+
+// Resolver looks up the mail exchangers of a domain, *net.Resolver satisfies it.
+type Resolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+}
+
+type domainSet map[string]struct{}
+
+// contains reports whether the domain or one of its parent domains is in the set.
+func (s domainSet) contains(domain string) bool {
+	for domain != "" {
+		if _, ok := s[domain]; ok {
+			return true
+		}
+
+		_, parent, found := strings.Cut(domain, ".")
+		if !found {
+			return false
+		}
+		domain = parent
+	}
+
+	return false
+}
+
+// DomainFilter decides which email domains may register. The allow and deny
+// lists are read from files and reloaded by Run when they change.
+type DomainFilter struct {
+	log        *zap.SugaredLogger
+	cfg        config.EmailDomainsConfig
+	resolver   Resolver
+	rejected   metric.Int64Counter
+	disposable domainSet
+
+	mu       sync.RWMutex
+	allow    domainSet
+	deny     domainSet
+	allowMod time.Time
+	denyMod  time.Time
+}
+
+func NewDomainFilter(log *zap.SugaredLogger, cfg config.EmailDomainsConfig, resolver Resolver, meter metric.Meter) (*DomainFilter, error) {
+	rejected, err := meter.Int64Counter("auth.signup.rejected_domains",
+		metric.WithDescription("Registrations rejected because of their email domain"))
+	if err != nil {
+		return nil, err
+	}
+
+	f := &DomainFilter{log: log, cfg: cfg, resolver: resolver, rejected: rejected, disposable: domainSet{}}
+
+	if cfg.BlockDisposable {
+		bundled, err := lists.Open("lists/disposable_domains.txt")
+		if err != nil {
+			return nil, err
+		}
+		defer bundled.Close()
+
+		if f.disposable, err = readDomains(bundled); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Run reloads the allow and deny lists whenever their files change, until
+// ctx is cancelled. A list that fails to load keeps its previous contents.
+func (f *DomainFilter) Run(ctx context.Context) {
+	if f.cfg.ReloadIntervalSeconds <= 0 || (f.cfg.AllowListPath == "" && f.cfg.DenyListPath == "") {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(f.cfg.ReloadIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := f.reload(); err != nil {
+				f.log.Errorf("cannot reload email domain lists: %v", err.Error())
+			}
+		}
+	}
+}
+
+// Check returns the reason the domain of a normalized address is rejected,
+// or an empty string when it may register. MX lookup failures other than a
+// missing domain are returned as errors and should not block the signup.
+func (f *DomainFilter) Check(ctx context.Context, address string) (string, error) {
+	_, domain, ok := strings.Cut(address, "@")
+	if !ok {
+		return "", ErrInvalidAddress
+	}
+
+	reason, err := f.check(ctx, domain)
+
+	if reason != "" {
+		f.rejected.Add(ctx, 1, metric.WithAttributes(attribute.String("reason", reason)))
+	}
+
+	return reason, err
+}
+
+func (f *DomainFilter) check(ctx context.Context, domain string) (string, error) {
+	f.mu.RLock()
+	allowed := f.allow.contains(domain)
+	denied := f.deny.contains(domain)
+	f.mu.RUnlock()
+
+	if allowed {
+		return "", nil
+	}
+
+	if f.cfg.AllowListOnly {
+		return RejectNotAllowed, nil
+	}
+
+	if denied {
+		return RejectDenied, nil
+	}
+
+	if f.disposable.contains(domain) {
+		return RejectDisposable, nil
+	}
+
+	if f.cfg.CheckMX && f.resolver != nil {
+		return f.checkMX(ctx, domain)
+	}
+
+	return "", nil
+}
+
+func (f *DomainFilter) checkMX(ctx context.Context, domain string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(f.cfg.MXTimeoutMillis)*time.Millisecond)
+	defer cancel()
+
+	records, err := f.resolver.LookupMX(ctx, domain)
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return RejectNoMX, nil
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("cannot lookup mx of %s: %w", domain, err)
+	}
+
+	// a single "." record is a null MX, the domain accepts no mail
+	if len(records) == 0 || (len(records) == 1 && records[0].Host == ".") {
+		return RejectNoMX, nil
+	}
+
+	return "", nil
+}
+
+// reload reads the allow and deny list files that changed since the last load.
+func (f *DomainFilter) reload() error {
+	allow, allowMod, err := loadDomainFile(f.cfg.AllowListPath, f.allowMod)
+	if err != nil {
+		return err
+	}
+
+	deny, denyMod, err := loadDomainFile(f.cfg.DenyListPath, f.denyMod)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if allow != nil {
+		f.allow, f.allowMod = allow, allowMod
+	}
+
+	if deny != nil {
+		f.deny, f.denyMod = deny, denyMod
+	}
+
+	return nil
+}
+
+// loadDomainFile returns the domains of the file, or nil when it has not been
+// modified since loadedAt. An empty path yields an empty set.
+func loadDomainFile(path string, loadedAt time.Time) (domainSet, time.Time, error) {
+	if path == "" {
+		return domainSet{}, time.Time{}, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	if !info.ModTime().After(loadedAt) {
+		return nil, loadedAt, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer file.Close()
+
+	domains, err := readDomains(file)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return domains, info.ModTime(), nil
+}
+
+// readDomains parses one domain per line, skipping blank lines and # comments.
+func readDomains(r io.Reader) (domainSet, error) {
+	domains := domainSet{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSuffix(strings.TrimSpace(line), ".")
+
+		if line == "" {
+			continue
+		}
+
+		domain, err := idna.Lookup.ToASCII(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid domain %q: %w", line, err)
+		}
+
+		domains[strings.ToLower(domain)] = struct{}{}
+	}
+
+	return domains, scanner.Err()
+}
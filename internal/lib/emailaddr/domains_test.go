@@ -0,0 +1,164 @@
+package emailaddr
+
+import (
+	"context"
+	"errors"
+	"github.com/Verce11o/yata-auth/config"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.uber.org/zap"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDomainSetContains(t *testing.T) {
+	set := domainSet{"example.com": {}, "mail.example.org": {}, "com.ru": {}}
+
+	tests := []struct {
+		domain string
+		want   bool
+	}{
+		{domain: "example.com", want: true},
+		{domain: "eu.mx.example.com", want: true},
+		{domain: "mail.example.org", want: true},
+		{domain: "a.mail.example.org", want: true},
+		{domain: "example.org", want: false},
+		{domain: "notexample.com", want: false},
+		{domain: "com", want: false},
+		{domain: "com.ru", want: true},
+		{domain: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			if got := set.contains(tt.domain); got != tt.want {
+				t.Errorf("contains(%q) = %v, want %v", tt.domain, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadDomains(t *testing.T) {
+	input := strings.Join([]string{
+		"# comment",
+		"",
+		"  Example.COM  ",
+		"trailing.dot.",
+		"inline.org # comment",
+		"bücher.de",
+	}, "\n")
+
+	domains, err := readDomains(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("readDomains: %v", err)
+	}
+
+	want := []string{"example.com", "trailing.dot", "inline.org", "xn--bcher-kva.de"}
+	if len(domains) != len(want) {
+		t.Errorf("readDomains() = %v, want %v", domains, want)
+	}
+
+	for _, domain := range want {
+		if _, ok := domains[domain]; !ok {
+			t.Errorf("readDomains() is missing %s", domain)
+		}
+	}
+}
+
+type fakeResolver map[string][]*net.MX
+
+func (r fakeResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	if name == "timeout.test" {
+		return nil, &net.DNSError{Err: "i/o timeout", Name: name, IsTimeout: true}
+	}
+
+	records, ok := r[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+
+	return records, nil
+}
+
+func TestDomainFilterCheck(t *testing.T) {
+	dir := t.TempDir()
+
+	allowPath := filepath.Join(dir, "allow.txt")
+	denyPath := filepath.Join(dir, "deny.txt")
+
+	if err := os.WriteFile(allowPath, []byte("partner.com\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(denyPath, []byte("spam.com\nmailinator.com\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	resolver := fakeResolver{
+		"example.com": {{Host: "mx.example.com.", Pref: 10}},
+		"partner.com": {{Host: "mx.partner.com.", Pref: 10}},
+		"nullmx.com":  {{Host: ".", Pref: 0}},
+		"mx.spam.com": {{Host: "mx.spam.com.", Pref: 10}},
+	}
+
+	base := config.EmailDomainsConfig{
+		AllowListPath:   allowPath,
+		DenyListPath:    denyPath,
+		BlockDisposable: true,
+		CheckMX:         true,
+		MXTimeoutMillis: 100,
+	}
+
+	allowOnly := base
+	allowOnly.AllowListOnly = true
+
+	tests := []struct {
+		name    string
+		cfg     config.EmailDomainsConfig
+		address string
+		want    string
+		wantErr bool
+	}{
+		{name: "accepted", cfg: base, address: "john@example.com"},
+		{name: "denied", cfg: base, address: "john@spam.com", want: RejectDenied},
+		{name: "denied subdomain", cfg: base, address: "john@mx.spam.com", want: RejectDenied},
+		{name: "disposable", cfg: base, address: "john@10minutemail.com", want: RejectDisposable},
+		{name: "allowed skips the other checks", cfg: base, address: "john@partner.com"},
+		{name: "no mx", cfg: base, address: "john@unknown.test", want: RejectNoMX},
+		{name: "null mx", cfg: base, address: "john@nullmx.com", want: RejectNoMX},
+		{name: "lookup failure lets the signup through", cfg: base, address: "john@timeout.test", wantErr: true},
+		{name: "allow list only", cfg: allowOnly, address: "john@example.com", want: RejectNotAllowed},
+		{name: "allow list only allowed", cfg: allowOnly, address: "john@partner.com"},
+		{name: "no domain", cfg: base, address: "john", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewDomainFilter(zap.NewNop().Sugar(), tt.cfg, resolver, noop.NewMeterProvider().Meter(""))
+			if err != nil {
+				t.Fatalf("NewDomainFilter: %v", err)
+			}
+
+			got, err := f.Check(context.Background(), tt.address)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Check(%q) error = %v, want error %v", tt.address, err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("Check(%q) = %q, want %q", tt.address, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewDomainFilterMissingList(t *testing.T) {
+	cfg := config.EmailDomainsConfig{DenyListPath: filepath.Join(t.TempDir(), "missing.txt")}
+
+	_, err := NewDomainFilter(zap.NewNop().Sugar(), cfg, nil, noop.NewMeterProvider().Meter(""))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("NewDomainFilter() error = %v, want %v", err, os.ErrNotExist)
+	}
+}
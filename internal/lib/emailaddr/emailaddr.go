@@ -0,0 +1,97 @@
+package emailaddr
+
+import (
+	"errors"
+	"github.com/Verce11o/yata-auth/config"
+	"golang.org/x/net/idna"
+	"strings"
+)
+
+var ErrInvalidAddress = errors.New("invalid email address")
+
+// providerRule describes how a mailbox provider treats the local part:
+// whether dots are ignored and which separator starts a subaddress tag.
+type providerRule struct {
+	canonicalDomain string
+	ignoreDots      bool
+	tagSeparator    string
+}
+
+var providerRules = map[string]providerRule{
+	"gmail.com":      {canonicalDomain: "gmail.com", ignoreDots: true, tagSeparator: "+"},
+	"googlemail.com": {canonicalDomain: "gmail.com", ignoreDots: true, tagSeparator: "+"},
+	"outlook.com":    {tagSeparator: "+"},
+	"hotmail.com":    {tagSeparator: "+"},
+	"live.com":       {tagSeparator: "+"},
+	"icloud.com":     {tagSeparator: "+"},
+	"me.com":         {tagSeparator: "+"},
+	"fastmail.com":   {tagSeparator: "+"},
+	"protonmail.com": {tagSeparator: "+"},
+	"proton.me":      {tagSeparator: "+"},
+	"yahoo.com":      {tagSeparator: "-"},
+}
+
+// Normalizer canonicalizes email addresses so that addresses reaching the
+// same mailbox compare equal.
+type Normalizer struct {
+	providerRules bool
+}
+
+func NewNormalizer(cfg config.EmailNormalizationConfig) *Normalizer {
+	return &Normalizer{providerRules: cfg.ProviderRules}
+}
+
+// Normalize lowercases the address and encodes the domain with IDNA. The
+// result is what users are stored and looked up by.
+func (n *Normalizer) Normalize(address string) (string, error) {
+	local, domain, ok := strings.Cut(strings.TrimSpace(address), "@")
+	if !ok || local == "" || domain == "" || strings.Contains(domain, "@") {
+		return "", ErrInvalidAddress
+	}
+
+	domain, err := idna.Lookup.ToASCII(strings.TrimSuffix(domain, "."))
+	if err != nil {
+		return "", ErrInvalidAddress
+	}
+
+	return strings.ToLower(local) + "@" + strings.ToLower(domain), nil
+}
+
+// Canonical normalizes the address and, with provider rules enabled, removes
+// dots and subaddress tags for the providers that ignore them. It identifies
+// the mailbox to detect duplicate registrations, it is never a lookup key.
+func (n *Normalizer) Canonical(address string) (string, error) {
+	normalized, err := n.Normalize(address)
+	if err != nil {
+		return "", err
+	}
+
+	if !n.providerRules {
+		return normalized, nil
+	}
+
+	local, domain, _ := strings.Cut(normalized, "@")
+
+	rule, ok := providerRules[domain]
+	if !ok {
+		return normalized, nil
+	}
+
+	if tag := strings.Index(local, rule.tagSeparator); tag > 0 {
+		local = local[:tag]
+	}
+
+	if rule.ignoreDots {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+
+	if rule.canonicalDomain != "" {
+		domain = rule.canonicalDomain
+	}
+
+	if local == "" {
+		return "", ErrInvalidAddress
+	}
+
+	return local + "@" + domain, nil
+}
@@ -0,0 +1,72 @@
+package emailaddr
+
+import (
+	"errors"
+	"github.com/Verce11o/yata-auth/config"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+		wantErr error
+	}{
+		{address: "John.Doe@Example.COM", want: "john.doe@example.com"},
+		{address: "  john@example.com  ", want: "john@example.com"},
+		{address: "john@example.com.", want: "john@example.com"},
+		{address: "John.Doe+tag@GMail.com", want: "john.doe+tag@gmail.com"},
+		{address: "user@bücher.de", want: "user@xn--bcher-kva.de"},
+		{address: "user@BÜCHER.de", want: "user@xn--bcher-kva.de"},
+		{address: "john", wantErr: ErrInvalidAddress},
+		{address: "@example.com", wantErr: ErrInvalidAddress},
+		{address: "john@", wantErr: ErrInvalidAddress},
+		{address: "john@exa@mple.com", wantErr: ErrInvalidAddress},
+		{address: "john@exa mple.com", wantErr: ErrInvalidAddress},
+	}
+
+	// provider rules never apply to the normalized address
+	n := NewNormalizer(config.EmailNormalizationConfig{ProviderRules: true})
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			got, err := n.Normalize(tt.address)
+
+			if !errors.Is(err, tt.wantErr) || got != tt.want {
+				t.Errorf("Normalize(%q) = %q, %v, want %q, %v", tt.address, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	tests := []struct {
+		address       string
+		providerRules bool
+		want          string
+		wantErr       error
+	}{
+		{address: "J.O.H.N+news@Gmail.com", providerRules: false, want: "j.o.h.n+news@gmail.com"},
+		{address: "J.O.H.N+news@Gmail.com", providerRules: true, want: "john@gmail.com"},
+		{address: "john.doe@googlemail.com", providerRules: true, want: "johndoe@gmail.com"},
+		{address: "john.doe+work@outlook.com", providerRules: true, want: "john.doe@outlook.com"},
+		{address: "john-work@yahoo.com", providerRules: true, want: "john@yahoo.com"},
+		{address: "john+work@yahoo.com", providerRules: true, want: "john+work@yahoo.com"},
+		{address: "+tag@gmail.com", providerRules: true, want: "+tag@gmail.com"},
+		{address: "john.doe+tag@example.com", providerRules: true, want: "john.doe+tag@example.com"},
+		{address: "...@gmail.com", providerRules: true, wantErr: ErrInvalidAddress},
+		{address: "john", providerRules: true, wantErr: ErrInvalidAddress},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			n := NewNormalizer(config.EmailNormalizationConfig{ProviderRules: tt.providerRules})
+
+			got, err := n.Canonical(tt.address)
+
+			if !errors.Is(err, tt.wantErr) || got != tt.want {
+				t.Errorf("Canonical(%q) = %q, %v, want %q, %v", tt.address, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -9,16 +9,49 @@ import (
 )
 
 var (
-	ErrEmailExists        = errors.New("email already exists")
-	ErrInvalidCredentials = errors.New("invalid credentials")
-	ErrNotFound           = errors.New("not found")
-	ErrCodeExpired        = errors.New("code is expired")
-	ErrCodeInvalid        = errors.New("code is invalid")
-	ErrPasswordMismatch   = errors.New("password mismatch")
-	ErrGettingCode        = errors.New("error getting code")
-	ErrAlreadyVerified    = errors.New("user already verified")
+	ErrEmailExists         = errors.New("email already exists")
+	ErrInvalidCredentials  = errors.New("invalid credentials")
+	ErrNotFound            = errors.New("not found")
+	ErrCodeExpired         = errors.New("code is expired")
+	ErrCodeInvalid         = errors.New("code is invalid")
+	ErrPasswordMismatch    = errors.New("password mismatch")
+	ErrGettingCode         = errors.New("error getting code")
+	ErrAlreadyVerified     = errors.New("user already verified")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+	ErrInvalidToken        = errors.New("invalid token")
+	ErrMFAAlreadyEnabled   = errors.New("mfa already enabled")
+	ErrMFANotEnabled       = errors.New("mfa not enabled")
+	ErrInvalidMFACode      = errors.New("invalid mfa code")
+	ErrAccountLocked       = errors.New("account temporarily locked")
+	ErrTooManyAttempts     = errors.New("too many login attempts")
+	ErrWeakPassword        = errors.New("password does not satisfy the password policy")
+	ErrPasswordReused      = errors.New("password was used recently")
+	ErrInvalidArgument     = errors.New("invalid argument")
+	ErrEmailDomainRejected = errors.New("email domain is not accepted")
 )
 
+// FieldViolation describes why a single request field was rejected.
+type FieldViolation struct {
+	Field       string
+	Description string
+}
+
+// ValidationError wraps a sentinel error with the field violations that
+// caused it, so handlers can return them as errdetails.BadRequest.
+type ValidationError struct {
+	Err        error
+	Violations []FieldViolation
+}
+
+func (e *ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
 func ParseGRPCErrStatusCode(err error) codes.Code {
 	switch {
 	case errors.Is(err, sql.ErrNoRows):
@@ -35,18 +68,40 @@ func ParseGRPCErrStatusCode(err error) codes.Code {
 		return codes.Unauthenticated
 	case errors.Is(err, ErrCodeExpired):
 		return codes.InvalidArgument
+	case errors.Is(err, ErrCodeInvalid):
+		return codes.InvalidArgument
 	case errors.Is(err, ErrAlreadyVerified):
 		return codes.AlreadyExists
 	case errors.Is(err, ErrPasswordMismatch):
 		return codes.InvalidArgument
+	case errors.Is(err, ErrInvalidRefreshToken):
+		return codes.Unauthenticated
+	case errors.Is(err, ErrRefreshTokenReused):
+		return codes.Unauthenticated
+	case errors.Is(err, ErrInvalidToken):
+		return codes.Unauthenticated
+	case errors.Is(err, ErrMFAAlreadyEnabled):
+		return codes.AlreadyExists
+	case errors.Is(err, ErrMFANotEnabled):
+		return codes.FailedPrecondition
+	case errors.Is(err, ErrInvalidMFACode):
+		return codes.Unauthenticated
+	case errors.Is(err, ErrAccountLocked):
+		return codes.ResourceExhausted
+	case errors.Is(err, ErrTooManyAttempts):
+		return codes.ResourceExhausted
+	case errors.Is(err, ErrWeakPassword):
+		return codes.InvalidArgument
+	case errors.Is(err, ErrPasswordReused):
+		return codes.InvalidArgument
+	case errors.Is(err, ErrInvalidArgument):
+		return codes.InvalidArgument
+	case errors.Is(err, ErrEmailDomainRejected):
+		return codes.InvalidArgument
 	case errors.Is(err, ErrNotFound):
 		return codes.NotFound
 	case errors.Is(err, redis.Nil):
 		return codes.NotFound
-	case errors.Is(err, context.Canceled):
-		return codes.Canceled
-	case errors.Is(err, context.DeadlineExceeded):
-		return codes.DeadlineExceeded
 	}
 	return codes.Internal
 }
@@ -0,0 +1,87 @@
+package hasher
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Verce11o/yata-auth/config"
+	"strings"
+)
+
+const (
+	Argon2idAlgorithm = "argon2id"
+	BcryptAlgorithm   = "bcrypt"
+)
+
+var ErrInvalidHash = errors.New("invalid password hash")
+
+type Hasher interface {
+	Hash(password string) (string, error)
+	Verify(password string, encoded string) (bool, error)
+	NeedsRehash(encoded string) bool
+}
+
+// PasswordHasher hashes new passwords with the configured algorithm and
+// verifies hashes produced by any of the supported ones, including legacy
+// salted sha256 hashes.
+type PasswordHasher struct {
+	primary Hasher
+	argon2  *Argon2idHasher
+	bcrypt  *BcryptHasher
+	legacy  *LegacyHasher
+}
+
+func NewPasswordHasher(cfg config.HasherConfig, legacySalt string) (*PasswordHasher, error) {
+	h := &PasswordHasher{
+		argon2: NewArgon2idHasher(cfg.Argon2id),
+		bcrypt: NewBcryptHasher(cfg.BcryptCost),
+		legacy: NewLegacyHasher(legacySalt),
+	}
+
+	switch cfg.Algorithm {
+	case Argon2idAlgorithm, "":
+		h.primary = h.argon2
+	case BcryptAlgorithm:
+		h.primary = h.bcrypt
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm: %s", cfg.Algorithm)
+	}
+
+	return h, nil
+}
+
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	return h.primary.Hash(password)
+}
+
+// MaxPasswordBytes is the longest password in bytes the configured algorithm
+// can hash, zero means there is no limit.
+func (h *PasswordHasher) MaxPasswordBytes() int {
+	if h.primary == h.bcrypt {
+		return BcryptMaxPasswordBytes
+	}
+	return 0
+}
+
+func (h *PasswordHasher) Verify(password string, encoded string) (bool, error) {
+	return h.detect(encoded).Verify(password, encoded)
+}
+
+// NeedsRehash reports whether the hash was produced by another algorithm or
+// with other parameters than the ones currently configured.
+func (h *PasswordHasher) NeedsRehash(encoded string) bool {
+	hasher := h.detect(encoded)
+	if hasher != h.primary {
+		return true
+	}
+	return hasher.NeedsRehash(encoded)
+}
+
+func (h *PasswordHasher) detect(encoded string) Hasher {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return h.argon2
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return h.bcrypt
+	}
+	return h.legacy
+}
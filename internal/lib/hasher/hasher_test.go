@@ -0,0 +1,166 @@
+package hasher
+
+import (
+	"errors"
+	"github.com/Verce11o/yata-auth/config"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+var testArgon2id = config.Argon2idConfig{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func newTestHasher(t *testing.T, algorithm string) *PasswordHasher {
+	t.Helper()
+
+	h, err := NewPasswordHasher(config.HasherConfig{Algorithm: algorithm, Argon2id: testArgon2id, BcryptCost: bcrypt.MinCost}, "salt")
+	if err != nil {
+		t.Fatalf("NewPasswordHasher: %v", err)
+	}
+
+	return h
+}
+
+func TestPasswordHasherRoundTrip(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		prefix    string
+	}{
+		{algorithm: Argon2idAlgorithm, prefix: "$argon2id$v=19$m=64,t=1,p=1$"},
+		{algorithm: "", prefix: "$argon2id$"},
+		{algorithm: BcryptAlgorithm, prefix: "$2a$04$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			h := newTestHasher(t, tt.algorithm)
+
+			encoded, err := h.Hash("correct horse")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+
+			if !strings.HasPrefix(encoded, tt.prefix) {
+				t.Errorf("Hash() = %q, want prefix %q", encoded, tt.prefix)
+			}
+
+			if ok, err := h.Verify("correct horse", encoded); err != nil || !ok {
+				t.Errorf("Verify(correct) = %v, %v, want true", ok, err)
+			}
+
+			if ok, err := h.Verify("wrong horse", encoded); err != nil || ok {
+				t.Errorf("Verify(wrong) = %v, %v, want false", ok, err)
+			}
+
+			if h.NeedsRehash(encoded) {
+				t.Errorf("NeedsRehash() = true for a hash with the current parameters")
+			}
+		})
+	}
+}
+
+func TestPasswordHasherUnknownAlgorithm(t *testing.T) {
+	if _, err := NewPasswordHasher(config.HasherConfig{Algorithm: "md5"}, "salt"); err == nil {
+		t.Fatal("NewPasswordHasher() with an unknown algorithm returned no error")
+	}
+}
+
+func TestPasswordHasherMaxPasswordBytes(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		want      int
+	}{
+		{algorithm: Argon2idAlgorithm, want: 0},
+		{algorithm: BcryptAlgorithm, want: BcryptMaxPasswordBytes},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			h := newTestHasher(t, tt.algorithm)
+
+			if got := h.MaxPasswordBytes(); got != tt.want {
+				t.Fatalf("MaxPasswordBytes() = %v, want %v", got, tt.want)
+			}
+
+			if tt.want == 0 {
+				return
+			}
+
+			if _, err := h.Hash(strings.Repeat("a", tt.want)); err != nil {
+				t.Errorf("Hash() of %d bytes: %v", tt.want, err)
+			}
+
+			if _, err := h.Hash(strings.Repeat("a", tt.want+1)); err == nil {
+				t.Errorf("Hash() of %d bytes returned no error", tt.want+1)
+			}
+		})
+	}
+}
+
+func TestPasswordHasherNeedsRehash(t *testing.T) {
+	h := newTestHasher(t, Argon2idAlgorithm)
+
+	weaker := NewArgon2idHasher(config.Argon2idConfig{Memory: 32, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	weakerHash, _ := weaker.Hash("password")
+
+	shortSalt := NewArgon2idHasher(config.Argon2idConfig{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 8, KeyLength: 32})
+	shortSaltHash, _ := shortSalt.Hash("password")
+
+	bcryptHash, _ := NewBcryptHasher(bcrypt.MinCost).Hash("password")
+	legacyHash, _ := NewLegacyHasher("salt").Hash("password")
+
+	tests := []struct {
+		name    string
+		encoded string
+		want    bool
+	}{
+		{name: "other memory", encoded: weakerHash, want: true},
+		{name: "other salt length", encoded: shortSaltHash, want: true},
+		{name: "other algorithm", encoded: bcryptHash, want: true},
+		{name: "legacy", encoded: legacyHash, want: true},
+		{name: "malformed", encoded: "$argon2id$v=19$broken", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := h.NeedsRehash(tt.encoded); got != tt.want {
+				t.Errorf("NeedsRehash(%q) = %v, want %v", tt.encoded, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasswordHasherVerifyDetectsAlgorithm(t *testing.T) {
+	h := newTestHasher(t, Argon2idAlgorithm)
+
+	bcryptHash, _ := NewBcryptHasher(bcrypt.MinCost).Hash("password")
+	legacyHash, _ := NewLegacyHasher("salt").Hash("password")
+	otherSaltHash, _ := NewLegacyHasher("pepper").Hash("password")
+
+	tests := []struct {
+		name    string
+		encoded string
+		want    bool
+		wantErr error
+	}{
+		{name: "bcrypt", encoded: bcryptHash, want: true},
+		{name: "legacy", encoded: legacyHash, want: true},
+		{name: "legacy with another salt", encoded: otherSaltHash, want: false},
+		{name: "malformed argon2id", encoded: "$argon2id$v=19$m=64,t=1,p=1$!!!$!!!", wantErr: ErrInvalidHash},
+		{name: "argon2id of another version", encoded: "$argon2id$v=16$m=64,t=1,p=1$c2FsdA$a2V5", wantErr: ErrInvalidHash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := h.Verify("password", tt.encoded)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("Verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
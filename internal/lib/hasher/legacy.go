@@ -0,0 +1,35 @@
+package hasher
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+)
+
+// LegacyHasher verifies passwords hashed with the single sha256 and global
+// salt scheme used before PHC hashes were introduced. It must not be used to
+// hash new passwords.
+type LegacyHasher struct {
+	salt string
+}
+
+func NewLegacyHasher(salt string) *LegacyHasher {
+	return &LegacyHasher{salt: salt}
+}
+
+func (l *LegacyHasher) Hash(password string) (string, error) {
+	hash := sha256.New()
+	hash.Write([]byte(password))
+
+	return fmt.Sprintf("%x", hash.Sum([]byte(l.salt))), nil
+}
+
+func (l *LegacyHasher) Verify(password string, encoded string) (bool, error) {
+	hash, _ := l.Hash(password)
+
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(encoded)) == 1, nil
+}
+
+func (l *LegacyHasher) NeedsRehash(encoded string) bool {
+	return true
+}
@@ -0,0 +1,61 @@
+package meter
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/metric"
+	metricsdk "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"log"
+)
+
+type OtlpMetrics struct {
+	Exporter metricsdk.Exporter
+	Provider *metricsdk.MeterProvider
+	Meter    metric.Meter
+}
+
+func NewOtlpExporter(ctx context.Context) (metricsdk.Exporter, error) {
+	return otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithInsecure())
+}
+
+func NewMeterProvider(exp metricsdk.Exporter, ServiceName string) (*metricsdk.MeterProvider, error) {
+	r, err := resource.Merge(
+		resource.Default(),
+		resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String(ServiceName),
+		),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return metricsdk.NewMeterProvider(
+		metricsdk.WithReader(metricsdk.NewPeriodicReader(exp)),
+		metricsdk.WithResource(r),
+	), nil
+}
+
+// InitMeter exports metrics to the same OTLP collector as the traces.
+func InitMeter(serviceName string) *OtlpMetrics {
+	exporter, err := NewOtlpExporter(context.Background())
+	if err != nil {
+		log.Fatalf("initialize meter exporter: %v", err)
+	}
+
+	mp, err := NewMeterProvider(exporter, serviceName)
+	if err != nil {
+		log.Fatalf("initialize meter provider: %v", err)
+	}
+
+	otel.SetMeterProvider(mp)
+
+	return &OtlpMetrics{
+		Exporter: exporter,
+		Provider: mp,
+		Meter:    mp.Meter("main meter"),
+	}
+}
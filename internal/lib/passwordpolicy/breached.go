@@ -0,0 +1,161 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// rangePrefixLength is the length of the SHA-1 prefix used by the HIBP range
+// API and by the files the downloader writes for it.
+const rangePrefixLength = 5
+
+// BreachedList looks passwords up in an offline copy of the Pwned Passwords
+// SHA-1 list. The path is either a directory of range files named after the
+// five character hash prefix ("21BD1.txt", lines of "SUFFIX:COUNT"), or a
+// single file of "HASH:COUNT" lines ordered by hash, searched in place.
+// Passwords never leave the process.
+type BreachedList struct {
+	path     string
+	ranges   bool
+	minCount int
+}
+
+func NewBreachedList(path string, minCount int) (*BreachedList, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open breached password list: %w", err)
+	}
+
+	if minCount < 1 {
+		minCount = 1
+	}
+
+	return &BreachedList{path: path, ranges: info.IsDir(), minCount: minCount}, nil
+}
+
+// Contains reports whether the password appears in the list at least
+// minCount times.
+func (b *BreachedList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	if b.ranges {
+		return b.lookupRange(hash[:rangePrefixLength], hash[rangePrefixLength:])
+	}
+
+	return b.lookupSorted(hash)
+}
+
+func (b *BreachedList) lookupRange(prefix string, suffix string) (bool, error) {
+	f, err := os.Open(filepath.Join(b.path, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		hash, count, ok := parseLine(scanner.Text())
+		if ok && hash == suffix {
+			return count >= b.minCount, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
+
+// lookupSorted binary searches the ordered file for the first line whose
+// hash is not less than the target.
+func (b *BreachedList) lookupSorted(target string) (bool, error) {
+	f, err := os.Open(b.path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	size := info.Size()
+	lo, hi := int64(0), size
+
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		line, err := lineAfter(f, mid, size)
+		if err != nil {
+			return false, err
+		}
+
+		hash, _, _ := parseLine(line)
+		if line == "" || hash >= target {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+
+	line, err := lineAfter(f, lo, size)
+	if err != nil {
+		return false, err
+	}
+
+	hash, count, ok := parseLine(line)
+
+	return ok && hash == target && count >= b.minCount, nil
+}
+
+// lineAfter returns the first complete line that starts at or after offset,
+// or an empty string at the end of the file.
+func lineAfter(f *os.File, offset int64, size int64) (string, error) {
+	start := offset
+	if start > 0 {
+		start--
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(f, start, size-start))
+
+	if offset > 0 {
+		if _, err := reader.ReadString('\n'); err != nil {
+			if errors.Is(err, io.EOF) {
+				return "", nil
+			}
+			return "", err
+		}
+	}
+
+	line, err := reader.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func parseLine(line string) (string, int, bool) {
+	hash, rawCount, found := strings.Cut(strings.TrimSpace(line), ":")
+	if !found {
+		return "", 0, false
+	}
+
+	count, err := strconv.Atoi(rawCount)
+	if err != nil {
+		return "", 0, false
+	}
+
+	return strings.ToUpper(hash), count, true
+}
@@ -0,0 +1,142 @@
+package passwordpolicy
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestBreachedListSorted(t *testing.T) {
+	counts := map[string]int{
+		"password": 100,
+		"123456":   50,
+		"qwerty":   3,
+		"letmein":  1,
+	}
+
+	// filler hashes around the known ones exercise the binary search
+	for i := 0; i < 500; i++ {
+		counts[fmt.Sprintf("filler-%d", i)] = i + 1
+	}
+
+	passwords := make(map[string]string, len(counts))
+	var lines []string
+	for password, count := range counts {
+		passwords[sha1Hex(password)] = password
+		lines = append(lines, fmt.Sprintf("%s:%d", sha1Hex(password), count))
+	}
+	sort.Strings(lines)
+
+	first, _, _ := strings.Cut(lines[0], ":")
+	last, _, _ := strings.Cut(lines[len(lines)-1], ":")
+
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		minCount int
+		want     bool
+	}{
+		{name: "first line", password: passwords[first], minCount: 1, want: true},
+		{name: "last line", password: passwords[last], minCount: 1, want: true},
+		{name: "known", password: "password", minCount: 1, want: true},
+		{name: "below min count", password: "qwerty", minCount: 10, want: false},
+		{name: "at min count", password: "qwerty", minCount: 3, want: true},
+		{name: "single occurrence", password: "letmein", minCount: 1, want: true},
+		{name: "filler", password: "filler-499", minCount: 1, want: true},
+		{name: "unknown", password: "correct horse battery staple", minCount: 1, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := NewBreachedList(path, tt.minCount)
+			if err != nil {
+				t.Fatalf("NewBreachedList: %v", err)
+			}
+
+			got, err := list.Contains(tt.password)
+			if err != nil {
+				t.Fatalf("Contains: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("Contains(%q) = %v, want %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreachedListRanges(t *testing.T) {
+	dir := t.TempDir()
+
+	hash := sha1Hex("password")
+	content := fmt.Sprintf("%s:2\n%s:7\n", strings.Repeat("0", 35), hash[rangePrefixLength:])
+	if err := os.WriteFile(filepath.Join(dir, hash[:rangePrefixLength]+".txt"), []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		minCount int
+		want     bool
+	}{
+		{name: "known", password: "password", minCount: 1, want: true},
+		{name: "below min count", password: "password", minCount: 8, want: false},
+		{name: "missing range file", password: "correct horse battery staple", minCount: 1, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := NewBreachedList(dir, tt.minCount)
+			if err != nil {
+				t.Fatalf("NewBreachedList: %v", err)
+			}
+
+			got, err := list.Contains(tt.password)
+			if err != nil {
+				t.Fatalf("Contains: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("Contains(%q) = %v, want %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line  string
+		hash  string
+		count int
+		ok    bool
+	}{
+		{line: "abc:12", hash: "ABC", count: 12, ok: true},
+		{line: " ABC:3\r", hash: "ABC", count: 3, ok: true},
+		{line: "ABC", ok: false},
+		{line: "ABC:x", ok: false},
+		{line: "", ok: false},
+	}
+
+	for _, tt := range tests {
+		hash, count, ok := parseLine(tt.line)
+		if hash != tt.hash || count != tt.count || ok != tt.ok {
+			t.Errorf("parseLine(%q) = %q, %d, %v, want %q, %d, %v", tt.line, hash, count, ok, tt.hash, tt.count, tt.ok)
+		}
+	}
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
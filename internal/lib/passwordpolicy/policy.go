@@ -0,0 +1,150 @@
+package passwordpolicy
+
+import (
+	"github.com/Verce11o/yata-auth/config"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// minUserInfoLength is the shortest username or email local part that is
+// checked for similarity, shorter ones would reject too many passwords.
+const minUserInfoLength = 3
+
+// Violation describes a single rule the password does not satisfy.
+type Violation struct {
+	Rule        string
+	Description string
+}
+
+// UserInfo holds the account attributes a password must not resemble.
+type UserInfo struct {
+	Username string
+	Email    string
+}
+
+// Policy checks passwords against the configured rules and, when a
+// breached list is configured, against known leaked passwords.
+type Policy struct {
+	cfg      config.PasswordPolicyConfig
+	maxBytes int
+	breached *BreachedList
+}
+
+// NewPolicy builds the policy from config. maxBytes is the longest password
+// in bytes the password hasher can take, zero means there is no limit.
+func NewPolicy(cfg config.PasswordPolicyConfig, maxBytes int) (*Policy, error) {
+	p := &Policy{cfg: cfg, maxBytes: maxBytes}
+
+	if cfg.BreachedListPath != "" {
+		breached, err := NewBreachedList(cfg.BreachedListPath, cfg.BreachedMinCount)
+		if err != nil {
+			return nil, err
+		}
+
+		p.breached = breached
+	}
+
+	return p, nil
+}
+
+// HistoryDepth is the number of recent passwords that cannot be reused.
+func (p *Policy) HistoryDepth() int {
+	return p.cfg.HistoryDepth
+}
+
+// Check returns every rule the password violates, an empty result means the
+// password is accepted.
+func (p *Policy) Check(password string, user UserInfo) ([]Violation, error) {
+	var violations []Violation
+
+	length := utf8.RuneCountInString(password)
+
+	if length < p.cfg.MinLength {
+		violations = append(violations, Violation{Rule: "min_length", Description: "password is too short"})
+	}
+
+	if (p.cfg.MaxLength > 0 && length > p.cfg.MaxLength) || (p.maxBytes > 0 && len(password) > p.maxBytes) {
+		violations = append(violations, Violation{Rule: "max_length", Description: "password is too long"})
+	}
+
+	violations = append(violations, p.checkClasses(password)...)
+
+	if p.cfg.RejectUserInfo {
+		if v, ok := checkUserInfo(password, user); !ok {
+			violations = append(violations, v)
+		}
+	}
+
+	if p.breached != nil && password != "" {
+		breached, err := p.breached.Contains(password)
+		if err != nil {
+			return nil, err
+		}
+
+		if breached {
+			violations = append(violations, Violation{Rule: "breached", Description: "password has appeared in a data breach"})
+		}
+	}
+
+	return violations, nil
+}
+
+func (p *Policy) checkClasses(password string) []Violation {
+	var lower, upper, digit, symbol bool
+
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+
+	var violations []Violation
+
+	if p.cfg.RequireLower && !lower {
+		violations = append(violations, Violation{Rule: "lower", Description: "password must contain a lowercase letter"})
+	}
+
+	if p.cfg.RequireUpper && !upper {
+		violations = append(violations, Violation{Rule: "upper", Description: "password must contain an uppercase letter"})
+	}
+
+	if p.cfg.RequireDigit && !digit {
+		violations = append(violations, Violation{Rule: "digit", Description: "password must contain a digit"})
+	}
+
+	if p.cfg.RequireSymbol && !symbol {
+		violations = append(violations, Violation{Rule: "symbol", Description: "password must contain a symbol"})
+	}
+
+	return violations
+}
+
+// checkUserInfo rejects passwords that contain the username or the local part
+// of the email, or that are contained in them.
+func checkUserInfo(password string, user UserInfo) (Violation, bool) {
+	password = strings.ToLower(password)
+
+	localPart, _, _ := strings.Cut(user.Email, "@")
+
+	for _, info := range []string{user.Username, localPart} {
+		info = strings.ToLower(strings.TrimSpace(info))
+
+		if utf8.RuneCountInString(info) < minUserInfoLength || password == "" {
+			continue
+		}
+
+		if strings.Contains(password, info) || strings.Contains(info, password) {
+			return Violation{Rule: "user_info", Description: "password must not contain the username or email"}, false
+		}
+	}
+
+	return Violation{}, true
+}
@@ -0,0 +1,118 @@
+package passwordpolicy
+
+import (
+	"github.com/Verce11o/yata-auth/config"
+	"reflect"
+	"testing"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	cfg := config.PasswordPolicyConfig{
+		MinLength:      8,
+		MaxLength:      16,
+		RequireLower:   true,
+		RequireUpper:   true,
+		RequireDigit:   true,
+		RequireSymbol:  true,
+		RejectUserInfo: true,
+	}
+
+	user := UserInfo{Username: "vercello", Email: "john.doe@example.com"}
+
+	tests := []struct {
+		name     string
+		password string
+		want     []string
+	}{
+		{name: "accepted", password: "Tr0ub4dor&3", want: nil},
+		{name: "too short", password: "Ab1!", want: []string{"min_length"}},
+		{name: "too long", password: "Abcdefgh1!abcdefg", want: []string{"max_length"}},
+		{name: "length counts runes", password: "Пароль1!", want: nil},
+		{name: "missing classes", password: "abcdefghij", want: []string{"upper", "digit", "symbol"}},
+		{name: "space is a symbol", password: "Abc defg1", want: nil},
+		{name: "contains username", password: "Vercello1!x", want: []string{"user_info"}},
+		{name: "contains email local part", password: "X1!john.doe", want: []string{"user_info"}},
+		{name: "empty", password: "", want: []string{"min_length", "lower", "upper", "digit", "symbol"}},
+	}
+
+	policy, err := NewPolicy(cfg, 0)
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations, err := policy.Check(tt.password, user)
+			if err != nil {
+				t.Fatalf("Check: %v", err)
+			}
+
+			if got := rules(violations); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check(%q) = %v, want %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyCheckMaxBytes(t *testing.T) {
+	policy, err := NewPolicy(config.PasswordPolicyConfig{MaxLength: 128}, 12)
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		want     []string
+	}{
+		{name: "at the limit", password: "abcdefghijkl", want: nil},
+		{name: "over the limit", password: "abcdefghijklm", want: []string{"max_length"}},
+		// 7 runes but 14 bytes
+		{name: "counts bytes", password: "пароль1", want: []string{"max_length"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations, err := policy.Check(tt.password, UserInfo{})
+			if err != nil {
+				t.Fatalf("Check: %v", err)
+			}
+
+			if got := rules(violations); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check(%q) = %v, want %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckUserInfo(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		user     UserInfo
+		ok       bool
+	}{
+		{name: "unrelated", password: "correct horse", user: UserInfo{Username: "alice", Email: "alice@example.com"}, ok: true},
+		{name: "contains username case insensitive", password: "xxALICExx", user: UserInfo{Username: "alice"}, ok: false},
+		{name: "contained in username", password: "lic", user: UserInfo{Username: "alice"}, ok: false},
+		{name: "short username is ignored", password: "abcdef", user: UserInfo{Username: "ab"}, ok: true},
+		{name: "domain is ignored", password: "example.com!", user: UserInfo{Email: "bob@example.com"}, ok: true},
+		{name: "empty password", password: "", user: UserInfo{Username: "alice"}, ok: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := checkUserInfo(tt.password, tt.user); ok != tt.ok {
+				t.Errorf("checkUserInfo(%q) ok = %v, want %v", tt.password, ok, tt.ok)
+			}
+		})
+	}
+}
+
+func rules(violations []Violation) []string {
+	var rules []string
+	for _, v := range violations {
+		rules = append(rules, v.Rule)
+	}
+	return rules
+}
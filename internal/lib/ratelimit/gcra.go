@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// gcraScript stores the theoretical arrival time (TAT) of the next request
+// for every key and returns {allowed, retry after in ms}. All keys are checked
+// before any is updated, so a request denied by one key costs nothing on the
+// others.
+var gcraScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local emission = tonumber(ARGV[2])
+local burst_offset = tonumber(ARGV[3])
+
+local new_tats = {}
+local retry_after = 0
+
+for i, key in ipairs(KEYS) do
+	local tat = tonumber(redis.call('GET', key) or now)
+	if tat < now then
+		tat = now
+	end
+
+	new_tats[i] = tat + emission
+
+	local diff = now - (new_tats[i] - burst_offset)
+	if diff < 0 and -diff > retry_after then
+		retry_after = -diff
+	end
+end
+
+if retry_after > 0 then
+	return {0, retry_after}
+end
+
+for i, key in ipairs(KEYS) do
+	redis.call('SET', key, new_tats[i], 'PX', math.ceil(new_tats[i] - now))
+end
+
+return {1, 0}
+`)
+
+type Limit struct {
+	Rate   int
+	Period time.Duration
+	Burst  int
+}
+
+// emission is the interval between two requests at the steady rate in ms.
+// Limits of more than one request per ms are clamped to one, a zero interval
+// would make the script store its keys without a ttl.
+func (l Limit) emission() int64 {
+	emission := l.Period.Milliseconds() / int64(l.Rate)
+	if emission < 1 {
+		return 1
+	}
+	return emission
+}
+
+// Limiter implements the generic cell rate algorithm on top of redis so
+// limits are shared between all service instances.
+type Limiter struct {
+	client *redis.Client
+}
+
+func NewLimiter(client *redis.Client) *Limiter {
+	return &Limiter{client: client}
+}
+
+// Allow reports whether a request counted against every key is allowed and
+// if not, how long the caller has to wait before retrying. The request is
+// only charged to the keys when all of them allow it.
+func (l *Limiter) Allow(ctx context.Context, limit Limit, keys ...string) (bool, time.Duration, error) {
+	if limit.Rate <= 0 || limit.Period <= 0 || len(keys) == 0 {
+		return true, 0, nil
+	}
+
+	burst := limit.Burst
+	if burst < 1 {
+		burst = 1
+	}
+
+	emission := limit.emission()
+
+	redisKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		redisKeys = append(redisKeys, fmt.Sprintf("ratelimit:%s", key))
+	}
+
+	res, err := gcraScript.Run(ctx, l.client, redisKeys,
+		time.Now().UnixMilli(), emission, emission*int64(burst)).Int64Slice()
+
+	if err != nil {
+		return false, 0, err
+	}
+
+	return res[0] == 1, time.Duration(res[1]) * time.Millisecond, nil
+}
@@ -0,0 +1,141 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestAllowDisabledLimit(t *testing.T) {
+	// disabled limits never reach redis, the limiter has no client
+	l := NewLimiter(nil)
+
+	tests := []struct {
+		name  string
+		limit Limit
+		keys  []string
+	}{
+		{name: "zero rate", limit: Limit{Rate: 0, Period: time.Minute}, keys: []string{"ip:1"}},
+		{name: "zero period", limit: Limit{Rate: 10}, keys: []string{"ip:1"}},
+		{name: "no keys", limit: Limit{Rate: 10, Period: time.Minute}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, retryAfter, err := l.Allow(context.Background(), tt.limit, tt.keys...)
+			if err != nil || !allowed || retryAfter != 0 {
+				t.Errorf("Allow() = %v, %v, %v, want true, 0, nil", allowed, retryAfter, err)
+			}
+		})
+	}
+}
+
+func TestLimitEmission(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit Limit
+		want  int64
+	}{
+		{name: "per minute", limit: Limit{Rate: 60, Period: time.Minute}, want: 1000},
+		{name: "per second", limit: Limit{Rate: 4, Period: time.Second}, want: 250},
+		{name: "faster than a ms", limit: Limit{Rate: 5000, Period: time.Second}, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.limit.emission(); got != tt.want {
+				t.Errorf("emission() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestAllow runs against the redis at REDIS_ADDR.
+func TestAllow(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR is not set")
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	t.Cleanup(func() { client.Close() })
+
+	l := NewLimiter(client)
+	limit := Limit{Rate: 1, Period: time.Minute, Burst: 3}
+
+	tests := []struct {
+		name string
+		// exhaust is charged until it is denied before the checked request
+		exhaust []string
+		keys    []string
+		allowed bool
+		// free is a key of keys that must still allow a full burst afterwards
+		free string
+	}{
+		{name: "fresh key", keys: []string{"a"}, allowed: true},
+		{name: "exhausted key", exhaust: []string{"a"}, keys: []string{"a"}, allowed: false},
+		{name: "fresh keys together", keys: []string{"a", "b"}, allowed: true},
+		{name: "one exhausted key denies and charges nothing", exhaust: []string{"a"}, keys: []string{"a", "b"}, allowed: false, free: "b"},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			prefix := fmt.Sprintf("test:%d:%d:", time.Now().UnixNano(), i)
+
+			keys := make([]string, 0, len(tt.keys))
+			for _, key := range tt.keys {
+				keys = append(keys, prefix+key)
+			}
+
+			t.Cleanup(func() {
+				for _, key := range keys {
+					client.Del(ctx, "ratelimit:"+key)
+				}
+			})
+
+			for _, key := range tt.exhaust {
+				for n := 0; ; n++ {
+					allowed, _, err := l.Allow(ctx, limit, prefix+key)
+					if err != nil {
+						t.Fatalf("Allow: %v", err)
+					}
+
+					if !allowed {
+						if n != limit.Burst {
+							t.Fatalf("%s denied after %d requests, want %d", key, n, limit.Burst)
+						}
+						break
+					}
+				}
+			}
+
+			allowed, retryAfter, err := l.Allow(ctx, limit, keys...)
+			if err != nil {
+				t.Fatalf("Allow: %v", err)
+			}
+
+			if allowed != tt.allowed {
+				t.Fatalf("Allow() = %v, want %v", allowed, tt.allowed)
+			}
+
+			if !allowed && (retryAfter <= 0 || retryAfter > limit.Period/time.Duration(limit.Rate)) {
+				t.Errorf("retry after = %v, want within one emission interval", retryAfter)
+			}
+
+			if tt.free == "" {
+				return
+			}
+
+			for n := 0; n < limit.Burst; n++ {
+				allowed, _, err := l.Allow(ctx, limit, prefix+tt.free)
+				if err != nil || !allowed {
+					t.Fatalf("request %d on %s = %v, %v, want allowed", n+1, tt.free, allowed, err)
+				}
+			}
+		})
+	}
+}
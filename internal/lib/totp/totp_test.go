@@ -0,0 +1,186 @@
+package totp
+
+import (
+	"encoding/base64"
+	"github.com/Verce11o/yata-auth/config"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 seed of the RFC 6238 test vectors, "12345678901234567890".
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func newTestTOTP(t *testing.T) *TOTP {
+	t.Helper()
+
+	totp, err := NewTOTP(config.MFAConfig{
+		Issuer:        "Yata",
+		EncryptionKey: base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32))),
+	})
+	if err != nil {
+		t.Fatalf("NewTOTP: %v", err)
+	}
+
+	return totp
+}
+
+func TestGenerateRFC6238(t *testing.T) {
+	key, err := b32.DecodeString(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the last six digits of the eight digit SHA1 vectors of RFC 6238 appendix B
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+		{unix: 20000000000, want: "353130"},
+	}
+
+	for _, tt := range tests {
+		if got := generate(key, tt.unix/period); got != tt.want {
+			t.Errorf("generate(T=%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	totp := newTestTOTP(t)
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / period
+
+	key, _ := b32.DecodeString(rfcSecret)
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "current step", secret: rfcSecret, code: "050471", wantStep: step, wantOK: true},
+		{name: "lowercase secret", secret: strings.ToLower(rfcSecret), code: "050471", wantStep: step, wantOK: true},
+		{name: "previous step", secret: rfcSecret, code: generate(key, step-1), wantStep: step - 1, wantOK: true},
+		{name: "next step", secret: rfcSecret, code: generate(key, step+1), wantStep: step + 1, wantOK: true},
+		{name: "outside skew", secret: rfcSecret, code: generate(key, step-2)},
+		{name: "wrong code", secret: rfcSecret, code: "000000"},
+		{name: "short code", secret: rfcSecret, code: "05047"},
+		{name: "invalid secret", secret: "not base32!", code: "050471"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := totp.Validate(tt.secret, tt.code, now)
+			if ok != tt.wantOK || gotStep != tt.wantStep {
+				t.Errorf("Validate() = %d, %v, want %d, %v", gotStep, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	totp := newTestTOTP(t)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret: %v", err)
+	}
+
+	key, err := b32.DecodeString(secret)
+	if err != nil || len(key) != secretSize {
+		t.Errorf("GenerateSecret() = %q, want %d base32 encoded bytes", secret, secretSize)
+	}
+}
+
+func TestURI(t *testing.T) {
+	totp := newTestTOTP(t)
+
+	uri, err := url.Parse(totp.URI("john@example.com", rfcSecret))
+	if err != nil {
+		t.Fatalf("URI is not a valid url: %v", err)
+	}
+
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Yata:john@example.com" {
+		t.Errorf("URI() = %s, want otpauth://totp/Yata:john@example.com", uri)
+	}
+
+	query := uri.Query()
+	for param, want := range map[string]string{"secret": rfcSecret, "issuer": "Yata", "algorithm": "SHA1", "digits": "6", "period": "30"} {
+		if got := query.Get(param); got != want {
+			t.Errorf("URI() %s = %q, want %q", param, got, want)
+		}
+	}
+}
+
+func TestCipher(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32)))
+
+	c, err := NewCipher(key)
+	if err != nil {
+		t.Fatalf("NewCipher: %v", err)
+	}
+
+	encrypted, err := c.Encrypt(rfcSecret)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	if decrypted, err := c.Decrypt(encrypted); err != nil || decrypted != rfcSecret {
+		t.Errorf("Decrypt(Encrypt(s)) = %q, %v, want %q", decrypted, err, rfcSecret)
+	}
+
+	other, _ := c.Encrypt(rfcSecret)
+	if other == encrypted {
+		t.Errorf("Encrypt() reused a nonce")
+	}
+
+	tests := []struct {
+		name      string
+		encrypted string
+	}{
+		{name: "not base64", encrypted: "!!!"},
+		{name: "shorter than nonce", encrypted: base64.StdEncoding.EncodeToString([]byte("short"))},
+		{name: "tampered", encrypted: tamper(encrypted)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := c.Decrypt(tt.encrypted); err == nil {
+				t.Errorf("Decrypt(%q) returned no error", tt.encrypted)
+			}
+		})
+	}
+}
+
+func TestNewCipherKeyLength(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{name: "not base64", key: "!!!"},
+		{name: "16 bytes", key: base64.StdEncoding.EncodeToString(make([]byte, 16))},
+		{name: "empty", key: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewCipher(tt.key); err == nil {
+				t.Errorf("NewCipher() with a %s key returned no error", tt.name)
+			}
+		})
+	}
+}
+
+func tamper(encrypted string) string {
+	sealed, _ := base64.StdEncoding.DecodeString(encrypted)
+	sealed[len(sealed)-1] ^= 0xff
+	return base64.StdEncoding.EncodeToString(sealed)
+}
@@ -0,0 +1,15 @@
+package postgres
+
+import (
+	"context"
+	"github.com/Verce11o/yata-auth/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+func addAuditEvent(ctx context.Context, db sqlx.ExecerContext, event domain.AuditEvent) error {
+	q := "INSERT INTO audit_log (user_id, event, ip, user_agent) VALUES ($1, $2, $3, $4)"
+
+	_, err := db.ExecContext(ctx, q, event.UserID, event.Event, event.IP, event.UserAgent)
+
+	return err
+}
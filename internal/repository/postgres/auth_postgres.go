@@ -22,13 +22,18 @@ func NewAuthPostgres(db *sqlx.DB, tracer trace.Tracer) *AuthPostgres {
 	return &AuthPostgres{db: db, tracer: tracer}
 }
 
-func (s *AuthPostgres) Register(ctx context.Context, input *pb.RegisterRequest) (string, error) {
+// Register stores the user, an email whose canonical form is taken by another
+// user is rejected like an existing email.
+func (s *AuthPostgres) Register(ctx context.Context, input *pb.RegisterRequest, canonicalEmail string) (string, error) {
 	ctx, span := s.tracer.Start(ctx, "authPostgres.Register")
 	defer span.End()
 
 	var userID uuid.UUID
 
-	q := "INSERT INTO users (username, email, password) VALUES ($1, $2, $3) RETURNING user_id"
+	q := `WITH new_user AS (
+		INSERT INTO users (username, email, email_canonical, password) VALUES ($1, $2, $3, $4) RETURNING user_id, password
+	)
+	INSERT INTO password_history (user_id, password_hash) SELECT user_id, password FROM new_user RETURNING user_id`
 
 	stmt, err := s.db.PreparexContext(ctx, q)
 
@@ -36,7 +41,7 @@ func (s *AuthPostgres) Register(ctx context.Context, input *pb.RegisterRequest)
 		return "", err
 	}
 
-	err = stmt.QueryRowxContext(ctx, input.GetUsername(), input.GetEmail(), input.GetPassword()).Scan(&userID)
+	err = stmt.QueryRowxContext(ctx, input.GetUsername(), input.GetEmail(), canonicalEmail, input.GetPassword()).Scan(&userID)
 
 	var pgErr *pq.Error
 	ok := errors.As(err, &pgErr)
@@ -53,31 +58,73 @@ func (s *AuthPostgres) Register(ctx context.Context, input *pb.RegisterRequest)
 	return userID.String(), nil
 }
 
-func (s *AuthPostgres) AddVerificationCode(ctx context.Context, codeType string, code string, userID string) error {
+// AddVerificationCode stores the code and the email delivering it in one transaction.
+func (s *AuthPostgres) AddVerificationCode(ctx context.Context, code *domain.VerificationCode, email []byte) error {
 	ctx, span := s.tracer.Start(ctx, "authPostgres.AddVerificationCode")
 	defer span.End()
 
-	q := "INSERT INTO verification_codes (type, code, user_id) VALUES ($1, $2, $3)"
-
-	err := s.db.QueryRowxContext(ctx, q, codeType, code, userID).Err()
+	tx, err := s.db.BeginTxx(ctx, nil)
 
 	if err != nil {
 		return err
 	}
 
-	return nil
+	defer tx.Rollback()
+
+	// only the latest otp of a user is valid, it is looked up by user and type
+	if code.Format == domain.CodeFormatOTP {
+		q := `UPDATE verification_codes SET used_at = CURRENT_TIMESTAMP
+				WHERE user_id = $1 AND type = $2 AND format = $3 AND used_at IS NULL`
+
+		if _, err := tx.ExecContext(ctx, q, code.UserID, code.Type, code.Format); err != nil {
+			return err
+		}
+	}
+
+	q := "INSERT INTO verification_codes (type, code_hash, format, user_id, expire_date) VALUES ($1, $2, $3, $4, $5)"
+
+	if _, err := tx.ExecContext(ctx, q, code.Type, code.CodeHash, code.Format, code.UserID, code.ExpireDate); err != nil {
+		return err
+	}
+
+	if err := addOutboxMessage(ctx, tx, email); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+
+}
+
+// ConsumeVerificationCode deletes a link code and returns it, a code can be consumed only once.
+func (s *AuthPostgres) ConsumeVerificationCode(ctx context.Context, codeType string, codeHash string) (*domain.VerificationCode, error) {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.ConsumeVerificationCode")
+	defer span.End()
 
+	var verificationCode domain.VerificationCode
+
+	q := `DELETE FROM verification_codes WHERE type = $1 AND code_hash = $2 AND format = 'link' AND used_at IS NULL
+			RETURNING id, type, code_hash, format, attempts, user_id, expire_date`
+
+	err := s.db.QueryRowxContext(ctx, q, codeType, codeHash).StructScan(&verificationCode)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &verificationCode, nil
 }
 
-func (s *AuthPostgres) GetVerificationCode(ctx context.Context, codeID string) (*domain.VerificationCode, error) {
-	ctx, span := s.tracer.Start(ctx, "authPostgres.GetVerificationCode")
+// ConsumeUserVerificationCode deletes an otp of the user and returns it, a code can be consumed only once.
+func (s *AuthPostgres) ConsumeUserVerificationCode(ctx context.Context, userID string, codeType string, codeHash string) (*domain.VerificationCode, error) {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.ConsumeUserVerificationCode")
 	defer span.End()
 
 	var verificationCode domain.VerificationCode
 
-	q := "SELECT type, code, user_id, expire_date FROM verification_codes WHERE code = $1"
+	q := `DELETE FROM verification_codes WHERE user_id = $1 AND type = $2 AND code_hash = $3 AND format = 'otp' AND used_at IS NULL
+			RETURNING id, type, code_hash, format, attempts, user_id, expire_date`
 
-	err := s.db.QueryRowxContext(ctx, q, codeID).StructScan(&verificationCode)
+	err := s.db.QueryRowxContext(ctx, q, userID, codeType, codeHash).StructScan(&verificationCode)
 
 	if err != nil {
 		return nil, err
@@ -86,11 +133,43 @@ func (s *AuthPostgres) GetVerificationCode(ctx context.Context, codeID string) (
 	return &verificationCode, nil
 }
 
+// IncrUserVerificationCodeAttempts counts a wrong guess of the pending otp of the user.
+func (s *AuthPostgres) IncrUserVerificationCodeAttempts(ctx context.Context, userID string, codeType string) (int64, int, error) {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.IncrUserVerificationCodeAttempts")
+	defer span.End()
+
+	var (
+		id       int64
+		attempts int
+	)
+
+	q := `UPDATE verification_codes SET attempts = attempts + 1
+			WHERE user_id = $1 AND type = $2 AND format = 'otp' AND used_at IS NULL
+			RETURNING id, attempts`
+
+	if err := s.db.QueryRowxContext(ctx, q, userID, codeType).Scan(&id, &attempts); err != nil {
+		return 0, 0, err
+	}
+
+	return id, attempts, nil
+}
+
+func (s *AuthPostgres) InvalidateVerificationCode(ctx context.Context, id int64) error {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.InvalidateVerificationCode")
+	defer span.End()
+
+	q := "UPDATE verification_codes SET used_at = CURRENT_TIMESTAMP WHERE id = $1 AND used_at IS NULL"
+
+	_, err := s.db.ExecContext(ctx, q, id)
+
+	return err
+}
+
 func (s *AuthPostgres) ClearVerificationCode(ctx context.Context, userID string, codeType string) error {
 	ctx, span := s.tracer.Start(ctx, "authPostgres.ClearVerificationCode")
 	defer span.End()
 
-	q := "DELETE FROM verification_codes WHERE user_id = $1 AND type = $2"
+	q := "DELETE FROM verification_codes WHERE user_id = $1 AND type = $2 AND used_at IS NULL"
 
 	_, err := s.db.ExecContext(ctx, q, userID, codeType)
 
@@ -117,15 +196,18 @@ func (s *AuthPostgres) VerifyUser(ctx context.Context, userID string) (*domain.U
 
 }
 
-func (s *AuthPostgres) GetUser(ctx context.Context, email string) (domain.User, error) {
+// GetUser looks the user up by email and falls back to the canonical email, so
+// users stored while provider rules applied to the email can still log in.
+func (s *AuthPostgres) GetUser(ctx context.Context, email string, canonicalEmail string) (domain.User, error) {
 	ctx, span := s.tracer.Start(ctx, "authPostgres.GetUser")
 	defer span.End()
 
 	var user domain.User
 
-	q := "SELECT * FROM users WHERE email = $1"
+	q := `SELECT * FROM users WHERE lower(email) = lower($1) OR email_canonical = $2
+			ORDER BY lower(email) = lower($1) DESC LIMIT 1`
 
-	err := s.db.QueryRowxContext(ctx, q, email).StructScan(&user)
+	err := s.db.QueryRowxContext(ctx, q, email, canonicalEmail).StructScan(&user)
 
 	if err != nil && errors.Is(err, sql.ErrNoRows) {
 		return domain.User{}, sql.ErrNoRows
@@ -164,8 +246,111 @@ func (s *AuthPostgres) GetUserByID(ctx context.Context, userID string) (domain.U
 
 }
 
+// ResetPassword updates the password, records it in the password history
+// keeping historyDepth entries, drops the pending codes of codeType and
+// revokes every token of the user in one transaction. It returns the new token
+// version and the revoked session IDs.
+func (s *AuthPostgres) ResetPassword(ctx context.Context, userID string, password string, codeType string, historyDepth int) (int, []string, error) {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.ResetPassword")
+	defer span.End()
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	defer tx.Rollback()
+
+	q := "UPDATE users SET password = $1, updated_at = CURRENT_TIMESTAMP WHERE user_id = $2"
+
+	res, err := tx.ExecContext(ctx, q, password, userID)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	rows, err := res.RowsAffected()
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if rows == 0 {
+		return 0, nil, sql.ErrNoRows
+	}
+
+	if err := addPasswordHistory(ctx, tx, userID, password, historyDepth); err != nil {
+		return 0, nil, err
+	}
+
+	q = "DELETE FROM verification_codes WHERE user_id = $1 AND type = $2 AND used_at IS NULL"
+
+	if _, err := tx.ExecContext(ctx, q, userID, codeType); err != nil {
+		return 0, nil, err
+	}
+
+	version, sessionIDs, err := revokeUserTokens(ctx, tx, userID, "")
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, nil, err
+	}
+
+	return version, sessionIDs, nil
+}
+
+// ChangePassword updates the password, records it in the password history
+// keeping historyDepth entries, revokes every other session of the user and
+// records the audit event and the notification email in one transaction.
+func (s *AuthPostgres) ChangePassword(ctx context.Context, userID string, password string, historyDepth int, keepSessionID string, audit domain.AuditEvent, email []byte) (int, []string, error) {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.ChangePassword")
+	defer span.End()
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	defer tx.Rollback()
+
+	q := "UPDATE users SET password = $1, updated_at = CURRENT_TIMESTAMP WHERE user_id = $2"
+
+	if _, err := tx.ExecContext(ctx, q, password, userID); err != nil {
+		return 0, nil, err
+	}
+
+	if err := addPasswordHistory(ctx, tx, userID, password, historyDepth); err != nil {
+		return 0, nil, err
+	}
+
+	version, sessionIDs, err := revokeUserTokens(ctx, tx, userID, keepSessionID)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err := addAuditEvent(ctx, tx, audit); err != nil {
+		return 0, nil, err
+	}
+
+	if err := addOutboxMessage(ctx, tx, email); err != nil {
+		return 0, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, nil, err
+	}
+
+	return version, sessionIDs, nil
+}
+
 func (s *AuthPostgres) UpdatePassword(ctx context.Context, userID string, password string) error {
-	ctx, span := s.tracer.Start(ctx, "authPostgres.GetUserByID")
+	ctx, span := s.tracer.Start(ctx, "authPostgres.UpdatePassword")
 	defer span.End()
 
 	q := "UPDATE users SET password = $1, updated_at = CURRENT_TIMESTAMP WHERE user_id = $2"
@@ -173,10 +358,14 @@ func (s *AuthPostgres) UpdatePassword(ctx context.Context, userID string, passwo
 	res, err := s.db.ExecContext(ctx, q, password, userID)
 
 	if err != nil {
-		return nil
+		return err
 	}
 
-	rows, _ := res.RowsAffected()
+	rows, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
 
 	if rows == 0 {
 		return sql.ErrNoRows
@@ -185,3 +374,76 @@ func (s *AuthPostgres) UpdatePassword(ctx context.Context, userID string, passwo
 	return nil
 
 }
+
+// ListUserEmails returns the id, email and creation time of every user,
+// oldest first.
+func (s *AuthPostgres) ListUserEmails(ctx context.Context) ([]domain.User, error) {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.ListUserEmails")
+	defer span.End()
+
+	var users []domain.User
+
+	q := "SELECT user_id, email, created_at FROM users ORDER BY created_at, user_id"
+
+	if err := s.db.SelectContext(ctx, &users, q); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// ListUsersWithoutEmailCanonical returns up to limit users with no canonical
+// email stored and a user id greater than after, ordered by user id.
+func (s *AuthPostgres) ListUsersWithoutEmailCanonical(ctx context.Context, after uuid.UUID, limit int) ([]domain.User, error) {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.ListUsersWithoutEmailCanonical")
+	defer span.End()
+
+	var users []domain.User
+
+	q := `SELECT user_id, email, created_at FROM users
+			WHERE email_canonical IS NULL AND user_id > $1 ORDER BY user_id LIMIT $2`
+
+	if err := s.db.SelectContext(ctx, &users, q, after, limit); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// BackfillEmailCanonical stores the canonical emails of the given users in one
+// transaction. Only users without a canonical email are updated, so values
+// written by registrations running at the same time are kept.
+func (s *AuthPostgres) BackfillEmailCanonical(ctx context.Context, canonicalEmails map[uuid.UUID]string) (int64, error) {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.BackfillEmailCanonical")
+	defer span.End()
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	q := "UPDATE users SET email_canonical = $1 WHERE user_id = $2 AND email_canonical IS NULL"
+
+	var updated int64
+
+	for userID, canonicalEmail := range canonicalEmails {
+		res, err := tx.ExecContext(ctx, q, canonicalEmail, userID)
+
+		if err != nil {
+			return 0, err
+		}
+
+		rows, err := res.RowsAffected()
+
+		if err != nil {
+			return 0, err
+		}
+
+		updated += rows
+	}
+
+	return updated, tx.Commit()
+}
@@ -0,0 +1,156 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/Verce11o/yata-auth/internal/domain"
+	"github.com/Verce11o/yata-auth/internal/lib/grpc_errors"
+	"github.com/jmoiron/sqlx"
+)
+
+func (s *AuthPostgres) GetUserMFA(ctx context.Context, userID string) (*domain.UserMFA, error) {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.GetUserMFA")
+	defer span.End()
+
+	var mfa domain.UserMFA
+
+	q := "SELECT user_id, secret, enabled, confirmed_at, created_at FROM user_mfa WHERE user_id = $1"
+
+	err := s.db.QueryRowxContext(ctx, q, userID).StructScan(&mfa)
+
+	if err != nil && errors.Is(err, sql.ErrNoRows) {
+		return nil, grpc_errors.ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &mfa, nil
+}
+
+// SaveUserMFASecret stores a pending enrollment, replacing any unconfirmed one.
+func (s *AuthPostgres) SaveUserMFASecret(ctx context.Context, userID string, secret string) error {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.SaveUserMFASecret")
+	defer span.End()
+
+	q := `INSERT INTO user_mfa (user_id, secret) VALUES ($1, $2)
+			ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, created_at = CURRENT_TIMESTAMP WHERE user_mfa.enabled = false`
+
+	res, err := s.db.ExecContext(ctx, q, userID, secret)
+
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return grpc_errors.ErrMFAAlreadyEnabled
+	}
+
+	return nil
+}
+
+func (s *AuthPostgres) EnableUserMFA(ctx context.Context, userID string, recoveryCodeHashes []string) error {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.EnableUserMFA")
+	defer span.End()
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	q := "UPDATE user_mfa SET enabled = true, confirmed_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND enabled = false"
+
+	res, err := tx.ExecContext(ctx, q, userID)
+
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return grpc_errors.ErrMFAAlreadyEnabled
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *AuthPostgres) ReplaceRecoveryCodes(ctx context.Context, userID string, recoveryCodeHashes []string) error {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.ReplaceRecoveryCodes")
+	defer span.End()
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode marks an unused recovery code as used.
+func (s *AuthPostgres) UseRecoveryCode(ctx context.Context, userID string, codeHash string) error {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.UseRecoveryCode")
+	defer span.End()
+
+	q := "UPDATE recovery_codes SET used_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL"
+
+	res, err := s.db.ExecContext(ctx, q, userID, codeHash)
+
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return grpc_errors.ErrInvalidMFACode
+	}
+
+	return nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sqlx.Tx, userID string, recoveryCodeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+
+	q := "INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)"
+
+	for _, codeHash := range recoveryCodeHashes {
+		if _, err := tx.ExecContext(ctx, q, userID, codeHash); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
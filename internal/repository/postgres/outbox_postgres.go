@@ -0,0 +1,121 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Verce11o/yata-auth/internal/domain"
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/propagation"
+	"time"
+)
+
+const maxOutboxRetryDelay = 10 * time.Minute
+
+func (s *AuthPostgres) AddOutboxMessage(ctx context.Context, payload []byte) error {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.AddOutboxMessage")
+	defer span.End()
+
+	return addOutboxMessage(ctx, s.db, payload)
+}
+
+// ClaimOutbox leases up to limit pending messages to the caller for lease.
+// The claim commits right away, so no lock is held while the messages are
+// published. Messages that are neither deleted nor retried before the lease
+// runs out are claimed again, and several service instances can run the relay
+// at once without picking the same message.
+func (s *AuthPostgres) ClaimOutbox(ctx context.Context, limit int, maxAttempts int, lease time.Duration) ([]domain.OutboxMessage, error) {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.ClaimOutbox")
+	defer span.End()
+
+	var messages []domain.OutboxMessage
+
+	q := `UPDATE email_outbox SET next_attempt_at = $1
+			WHERE id IN (
+				SELECT id FROM email_outbox
+				WHERE attempts < $2 AND next_attempt_at <= CURRENT_TIMESTAMP
+				ORDER BY id LIMIT $3 FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, payload, trace_context, attempts, created_at`
+
+	if err := s.db.SelectContext(ctx, &messages, q, time.Now().Add(lease), maxAttempts, limit); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// DeleteOutboxMessage removes a delivered message, its payload holds
+// plaintext links and codes.
+func (s *AuthPostgres) DeleteOutboxMessage(ctx context.Context, id int64) error {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.DeleteOutboxMessage")
+	defer span.End()
+
+	q := "DELETE FROM email_outbox WHERE id = $1"
+
+	_, err := s.db.ExecContext(ctx, q, id)
+
+	return err
+}
+
+// RetryOutboxMessage records a failed delivery and schedules the next attempt
+// with exponential back-off.
+func (s *AuthPostgres) RetryOutboxMessage(ctx context.Context, msg domain.OutboxMessage, lastError string) error {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.RetryOutboxMessage")
+	defer span.End()
+
+	q := "UPDATE email_outbox SET attempts = attempts + 1, last_error = $1, next_attempt_at = $2 WHERE id = $3"
+
+	_, err := s.db.ExecContext(ctx, q, lastError, time.Now().Add(outboxRetryDelay(msg.Attempts+1)), msg.ID)
+
+	return err
+}
+
+// PurgeOutbox deletes the messages created before createdBefore, whether they
+// are still pending or ran out of attempts.
+func (s *AuthPostgres) PurgeOutbox(ctx context.Context, createdBefore time.Time) (int64, error) {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.PurgeOutbox")
+	defer span.End()
+
+	q := "DELETE FROM email_outbox WHERE created_at < $1"
+
+	res, err := s.db.ExecContext(ctx, q, createdBefore)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// addOutboxMessage stores the W3C trace context of ctx along with the payload,
+// so the relay can publish the email as part of the request trace.
+func addOutboxMessage(ctx context.Context, db sqlx.ExecerContext, payload []byte) error {
+	var traceContext *string
+
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+
+	if len(carrier) > 0 {
+		b, err := json.Marshal(carrier)
+		if err != nil {
+			return err
+		}
+
+		s := string(b)
+		traceContext = &s
+	}
+
+	q := "INSERT INTO email_outbox (payload, trace_context) VALUES ($1, $2)"
+
+	_, err := db.ExecContext(ctx, q, payload, traceContext)
+
+	return err
+}
+
+func outboxRetryDelay(attempts int) time.Duration {
+	delay := time.Second << attempts
+	if delay <= 0 || delay > maxOutboxRetryDelay {
+		return maxOutboxRetryDelay
+	}
+	return delay
+}
@@ -0,0 +1,41 @@
+package postgres
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+)
+
+// GetPasswordHistory returns up to limit of the most recent password hashes
+// of the user, the current one included.
+func (s *AuthPostgres) GetPasswordHistory(ctx context.Context, userID string, limit int) ([]string, error) {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.GetPasswordHistory")
+	defer span.End()
+
+	var hashes []string
+
+	q := "SELECT password_hash FROM password_history WHERE user_id = $1 ORDER BY id DESC LIMIT $2"
+
+	if err := s.db.SelectContext(ctx, &hashes, q, userID, limit); err != nil {
+		return nil, err
+	}
+
+	return hashes, nil
+}
+
+// addPasswordHistory records the new password hash and prunes everything
+// beyond the depth most recent entries of the user.
+func addPasswordHistory(ctx context.Context, db sqlx.ExecerContext, userID string, password string, depth int) error {
+	q := "INSERT INTO password_history (user_id, password_hash) VALUES ($1, $2)"
+
+	if _, err := db.ExecContext(ctx, q, userID, password); err != nil {
+		return err
+	}
+
+	q = `DELETE FROM password_history WHERE user_id = $1 AND id NOT IN (
+		SELECT id FROM password_history WHERE user_id = $1 ORDER BY id DESC LIMIT $2
+	)`
+
+	_, err := db.ExecContext(ctx, q, userID, depth)
+
+	return err
+}
@@ -0,0 +1,178 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/Verce11o/yata-auth/internal/domain"
+	"github.com/Verce11o/yata-auth/internal/lib/grpc_errors"
+	"github.com/google/uuid"
+	"time"
+)
+
+func (s *AuthPostgres) CreateSession(ctx context.Context, session *domain.Session) error {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.CreateSession")
+	defer span.End()
+
+	q := `INSERT INTO sessions (session_id, user_id, user_agent, ip, expire_date) VALUES ($1, $2, $3, $4, $5)
+			RETURNING created_at, last_seen_at`
+
+	err := s.db.QueryRowxContext(ctx, q, session.SessionID, session.UserID, session.UserAgent, session.IP, session.ExpireDate).
+		Scan(&session.CreatedAt, &session.LastSeenAt)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *AuthPostgres) GetSession(ctx context.Context, sessionID string) (*domain.Session, error) {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.GetSession")
+	defer span.End()
+
+	var session domain.Session
+
+	q := "SELECT session_id, user_id, user_agent, ip, created_at, last_seen_at, expire_date, revoked_at FROM sessions WHERE session_id = $1"
+
+	err := s.db.QueryRowxContext(ctx, q, sessionID).StructScan(&session)
+
+	if err != nil && errors.Is(err, sql.ErrNoRows) {
+		return nil, grpc_errors.ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (s *AuthPostgres) GetUserSessions(ctx context.Context, userID string) ([]domain.Session, error) {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.GetUserSessions")
+	defer span.End()
+
+	var sessions []domain.Session
+
+	q := `SELECT session_id, user_id, user_agent, ip, created_at, last_seen_at, expire_date, revoked_at FROM sessions
+			WHERE user_id = $1 AND revoked_at IS NULL AND expire_date > CURRENT_TIMESTAMP ORDER BY last_seen_at DESC`
+
+	if err := s.db.SelectContext(ctx, &sessions, q, userID); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (s *AuthPostgres) TouchSession(ctx context.Context, sessionID string, expireDate time.Time) error {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.TouchSession")
+	defer span.End()
+
+	q := "UPDATE sessions SET last_seen_at = CURRENT_TIMESTAMP, expire_date = $1 WHERE session_id = $2 AND revoked_at IS NULL"
+
+	_, err := s.db.ExecContext(ctx, q, expireDate, sessionID)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RevokeSession revokes the user's session together with its refresh tokens.
+func (s *AuthPostgres) RevokeSession(ctx context.Context, userID string, sessionID string) error {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.RevokeSession")
+	defer span.End()
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	q := "UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE session_id = $1 AND user_id = $2 AND revoked_at IS NULL"
+
+	res, err := tx.ExecContext(ctx, q, sessionID, userID)
+
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return grpc_errors.ErrNotFound
+	}
+
+	q = "UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE family_id = $1 AND revoked_at IS NULL"
+
+	if _, err := tx.ExecContext(ctx, q, sessionID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RevokeOtherSessions revokes every session of the user except the given one
+// and returns the IDs of the revoked sessions.
+func (s *AuthPostgres) RevokeOtherSessions(ctx context.Context, userID string, keepSessionID string) ([]string, error) {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.RevokeOtherSessions")
+	defer span.End()
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	keep, err := sessionParam(keepSessionID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var sessionIDs []string
+
+	q := `UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND session_id IS DISTINCT FROM $2 AND revoked_at IS NULL
+			RETURNING session_id`
+
+	if err := tx.SelectContext(ctx, &sessionIDs, q, userID, keep); err != nil {
+		return nil, err
+	}
+
+	q = "UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND family_id IS DISTINCT FROM $2 AND revoked_at IS NULL"
+
+	if _, err := tx.ExecContext(ctx, q, userID, keep); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return sessionIDs, nil
+}
+
+// sessionParam types an optional session ID as a uuid parameter, an empty ID
+// is NULL and matches no session.
+func sessionParam(sessionID string) (uuid.NullUUID, error) {
+	if sessionID == "" {
+		return uuid.NullUUID{}, nil
+	}
+
+	id, err := uuid.Parse(sessionID)
+
+	if err != nil {
+		return uuid.NullUUID{}, err
+	}
+
+	return uuid.NullUUID{UUID: id, Valid: true}, nil
+}
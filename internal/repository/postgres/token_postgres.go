@@ -0,0 +1,192 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/Verce11o/yata-auth/internal/domain"
+	"github.com/Verce11o/yata-auth/internal/lib/grpc_errors"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+func (s *AuthPostgres) CreateRefreshToken(ctx context.Context, token *domain.RefreshToken) error {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.CreateRefreshToken")
+	defer span.End()
+
+	q := "INSERT INTO refresh_tokens (token_id, family_id, user_id, token_hash, expire_date, access_token_id) VALUES ($1, $2, $3, $4, $5, $6)"
+
+	_, err := s.db.ExecContext(ctx, q, token.TokenID, token.FamilyID, token.UserID, token.TokenHash, token.ExpireDate, token.AccessTokenID)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *AuthPostgres) GetRefreshToken(ctx context.Context, tokenHash string) (*domain.RefreshToken, error) {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.GetRefreshToken")
+	defer span.End()
+
+	var token domain.RefreshToken
+
+	q := "SELECT * FROM refresh_tokens WHERE token_hash = $1"
+
+	err := s.db.QueryRowxContext(ctx, q, tokenHash).StructScan(&token)
+
+	if err != nil && errors.Is(err, sql.ErrNoRows) {
+		return nil, grpc_errors.ErrInvalidRefreshToken
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// RotateRefreshToken marks the old token as used and stores its replacement
+// in a single transaction. ErrRefreshTokenReused is returned if the old token has
+// already been rotated by a concurrent request.
+func (s *AuthPostgres) RotateRefreshToken(ctx context.Context, oldTokenID string, token *domain.RefreshToken) error {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.RotateRefreshToken")
+	defer span.End()
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	q := "UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP, replaced_by = $1 WHERE token_id = $2 AND revoked_at IS NULL"
+
+	res, err := tx.ExecContext(ctx, q, token.TokenID, oldTokenID)
+
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return grpc_errors.ErrRefreshTokenReused
+	}
+
+	q = "INSERT INTO refresh_tokens (token_id, family_id, user_id, token_hash, expire_date, access_token_id) VALUES ($1, $2, $3, $4, $5, $6)"
+
+	_, err = tx.ExecContext(ctx, q, token.TokenID, token.FamilyID, token.UserID, token.TokenHash, token.ExpireDate, token.AccessTokenID)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RevokeRefreshTokenFamily revokes every refresh token of the family and
+// returns the tokens created after issuedAfter, whose access tokens may still
+// be valid.
+func (s *AuthPostgres) RevokeRefreshTokenFamily(ctx context.Context, familyID string, issuedAfter time.Time) ([]domain.RefreshToken, error) {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.RevokeRefreshTokenFamily")
+	defer span.End()
+
+	q := "UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE family_id = $1 AND revoked_at IS NULL"
+
+	if _, err := s.db.ExecContext(ctx, q, familyID); err != nil {
+		return nil, err
+	}
+
+	var tokens []domain.RefreshToken
+
+	q = "SELECT * FROM refresh_tokens WHERE family_id = $1 AND created_at > $2 AND access_token_id IS NOT NULL"
+
+	if err := s.db.SelectContext(ctx, &tokens, q, familyID, issuedAfter); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func (s *AuthPostgres) GetTokenVersion(ctx context.Context, userID string) (int, error) {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.GetTokenVersion")
+	defer span.End()
+
+	var version int
+
+	q := "SELECT token_version FROM users WHERE user_id = $1"
+
+	if err := s.db.QueryRowxContext(ctx, q, userID).Scan(&version); err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// RevokeUserTokens bumps the token version of the user and revokes all of
+// their sessions and refresh tokens. It returns the new version and the
+// revoked session IDs.
+func (s *AuthPostgres) RevokeUserTokens(ctx context.Context, userID string) (int, []string, error) {
+	ctx, span := s.tracer.Start(ctx, "authPostgres.RevokeUserTokens")
+	defer span.End()
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	defer tx.Rollback()
+
+	version, sessionIDs, err := revokeUserTokens(ctx, tx, userID, "")
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, nil, err
+	}
+
+	return version, sessionIDs, nil
+}
+
+// revokeUserTokens keeps the session and refresh token family keepSessionID when it is set.
+func revokeUserTokens(ctx context.Context, tx *sqlx.Tx, userID string, keepSessionID string) (int, []string, error) {
+	var version int
+
+	q := "UPDATE users SET token_version = token_version + 1 WHERE user_id = $1 RETURNING token_version"
+
+	if err := tx.QueryRowxContext(ctx, q, userID).Scan(&version); err != nil {
+		return 0, nil, err
+	}
+
+	keep, err := sessionParam(keepSessionID)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var sessionIDs []string
+
+	q = `UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND session_id IS DISTINCT FROM $2 AND revoked_at IS NULL
+			RETURNING session_id`
+
+	if err := tx.SelectContext(ctx, &sessionIDs, q, userID, keep); err != nil {
+		return 0, nil, err
+	}
+
+	q = "UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND family_id IS DISTINCT FROM $2 AND revoked_at IS NULL"
+
+	if _, err := tx.ExecContext(ctx, q, userID, keep); err != nil {
+		return 0, nil, err
+	}
+
+	return version, sessionIDs, nil
+}
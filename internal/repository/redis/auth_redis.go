@@ -15,6 +15,25 @@ const (
 	userTTL = 3600
 )
 
+var setTokenVersionScript = redis.NewScript(`
+local current = tonumber(redis.call("GET", KEYS[1]))
+if current and current >= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+return 1
+`)
+
+// setSessionScript caches a session unless it has been revoked, so a read
+// racing with RevokeSessionsCtx cannot put the session back as active.
+var setSessionScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[2]) == 1 then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+return 1
+`)
+
 type AuthRedis struct {
 	client *redis.Client
 	tracer trace.Tracer
@@ -71,6 +90,328 @@ func (r *AuthRedis) DeleteUserCtx(ctx context.Context, key string) error {
 	return r.client.Del(ctx, r.createKey(key)).Err()
 }
 
+// RevokeTokenCtx adds the token to the revocation list until it would have expired anyway.
+func (r *AuthRedis) RevokeTokenCtx(ctx context.Context, tokenID string, ttl time.Duration) error {
+	ctx, span := r.tracer.Start(ctx, "authRedis.RevokeTokenCtx")
+	defer span.End()
+
+	if ttl <= 0 {
+		return nil
+	}
+
+	return r.client.Set(ctx, r.createRevokedTokenKey(tokenID), 1, ttl).Err()
+}
+
+func (r *AuthRedis) IsTokenRevokedCtx(ctx context.Context, tokenID string) (bool, error) {
+	ctx, span := r.tracer.Start(ctx, "authRedis.IsTokenRevokedCtx")
+	defer span.End()
+
+	n, err := r.client.Exists(ctx, r.createRevokedTokenKey(tokenID)).Result()
+
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+func (r *AuthRedis) GetTokenVersionCtx(ctx context.Context, userID string) (int, bool, error) {
+	ctx, span := r.tracer.Start(ctx, "authRedis.GetTokenVersionCtx")
+	defer span.End()
+
+	version, err := r.client.Get(ctx, fmt.Sprintf("token_version:%s", userID)).Int()
+
+	if err != nil {
+		if err == redis.Nil {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+
+	return version, true, nil
+}
+
+// SetTokenVersionCtx caches the token version unless a higher one is cached
+// already, so a fill that read postgres before a bump cannot overwrite it.
+func (r *AuthRedis) SetTokenVersionCtx(ctx context.Context, userID string, version int, ttl time.Duration) error {
+	ctx, span := r.tracer.Start(ctx, "authRedis.SetTokenVersionCtx")
+	defer span.End()
+
+	return setTokenVersionScript.Run(ctx, r.client, []string{fmt.Sprintf("token_version:%s", userID)}, version, ttl.Milliseconds()).Err()
+}
+
+func (r *AuthRedis) createRevokedTokenKey(tokenID string) string {
+	return fmt.Sprintf("revoked_token:%s", tokenID)
+}
+
 func (r *AuthRedis) createKey(key string) string {
 	return fmt.Sprintf("user:%s", key)
 }
+
+func (r *AuthRedis) GetSessionCtx(ctx context.Context, sessionID string) (*domain.Session, error) {
+	ctx, span := r.tracer.Start(ctx, "authRedis.GetSessionCtx")
+	defer span.End()
+
+	sessionBytes, err := r.client.Get(ctx, r.createSessionKey(sessionID)).Bytes()
+
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var session domain.Session
+
+	if err = json.Unmarshal(sessionBytes, &session); err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (r *AuthRedis) SetSessionCtx(ctx context.Context, session *domain.Session) error {
+	ctx, span := r.tracer.Start(ctx, "authRedis.SetSessionCtx")
+	defer span.End()
+
+	ttl := time.Until(session.ExpireDate)
+
+	if ttl <= 0 {
+		return nil
+	}
+
+	sessionBytes, err := json.Marshal(session)
+
+	if err != nil {
+		return err
+	}
+
+	sessionID := session.SessionID.String()
+
+	return setSessionScript.Run(ctx, r.client, []string{r.createSessionKey(sessionID), r.createRevokedSessionKey(sessionID)},
+		sessionBytes, ttl.Milliseconds()).Err()
+}
+
+// RevokeSessionsCtx drops the cached sessions and keeps a tombstone for ttl
+// that stops SetSessionCtx from caching them again.
+func (r *AuthRedis) RevokeSessionsCtx(ctx context.Context, ttl time.Duration, sessionIDs ...string) error {
+	ctx, span := r.tracer.Start(ctx, "authRedis.RevokeSessionsCtx")
+	defer span.End()
+
+	if len(sessionIDs) == 0 {
+		return nil
+	}
+
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, sessionID := range sessionIDs {
+			pipe.Set(ctx, r.createRevokedSessionKey(sessionID), 1, ttl)
+			pipe.Del(ctx, r.createSessionKey(sessionID))
+		}
+		return nil
+	})
+
+	return err
+}
+
+func (r *AuthRedis) createSessionKey(sessionID string) string {
+	return fmt.Sprintf("session:%s", sessionID)
+}
+
+func (r *AuthRedis) createRevokedSessionKey(sessionID string) string {
+	return fmt.Sprintf("session_revoked:%s", sessionID)
+}
+
+func (r *AuthRedis) SetMFAChallengeCtx(ctx context.Context, token string, challenge *domain.MFAChallenge, ttl time.Duration) error {
+	ctx, span := r.tracer.Start(ctx, "authRedis.SetMFAChallengeCtx")
+	defer span.End()
+
+	challengeBytes, err := json.Marshal(challenge)
+
+	if err != nil {
+		return err
+	}
+
+	return r.client.Set(ctx, r.createMFAChallengeKey(token), challengeBytes, ttl).Err()
+}
+
+// TakeMFAChallengeCtx reads and deletes the challenge in one transaction, so
+// only one request can redeem it. It also returns the remaining TTL, used to
+// put the challenge back after a wrong code.
+func (r *AuthRedis) TakeMFAChallengeCtx(ctx context.Context, token string) (*domain.MFAChallenge, time.Duration, error) {
+	ctx, span := r.tracer.Start(ctx, "authRedis.TakeMFAChallengeCtx")
+	defer span.End()
+
+	key := r.createMFAChallengeKey(token)
+
+	pipe := r.client.TxPipeline()
+	get := pipe.Get(ctx, key)
+	ttl := pipe.PTTL(ctx, key)
+	pipe.Del(ctx, key)
+
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, 0, err
+	}
+
+	challengeBytes, err := get.Bytes()
+
+	if err != nil {
+		if err == redis.Nil {
+			return nil, 0, nil
+		}
+		return nil, 0, err
+	}
+
+	var challenge domain.MFAChallenge
+
+	if err = json.Unmarshal(challengeBytes, &challenge); err != nil {
+		return nil, 0, err
+	}
+
+	return &challenge, ttl.Val(), nil
+}
+
+// IncrMFAChallengeAttemptsCtx counts failed second factor attempts for the challenge.
+func (r *AuthRedis) IncrMFAChallengeAttemptsCtx(ctx context.Context, token string, ttl time.Duration) (int64, error) {
+	ctx, span := r.tracer.Start(ctx, "authRedis.IncrMFAChallengeAttemptsCtx")
+	defer span.End()
+
+	key := r.createMFAChallengeKey(token) + ":attempts"
+
+	pipe := r.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, ttl)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	return incr.Val(), nil
+}
+
+func (r *AuthRedis) DeleteMFAChallengeCtx(ctx context.Context, token string) error {
+	ctx, span := r.tracer.Start(ctx, "authRedis.DeleteMFAChallengeCtx")
+	defer span.End()
+
+	key := r.createMFAChallengeKey(token)
+
+	return r.client.Del(ctx, key, key+":attempts").Err()
+}
+
+// MarkTOTPUsedCtx returns false if the code for this time step has already been used.
+func (r *AuthRedis) MarkTOTPUsedCtx(ctx context.Context, userID string, step int64, ttl time.Duration) (bool, error) {
+	ctx, span := r.tracer.Start(ctx, "authRedis.MarkTOTPUsedCtx")
+	defer span.End()
+
+	return r.client.SetNX(ctx, fmt.Sprintf("totp_used:%s:%d", userID, step), 1, ttl).Result()
+}
+
+func (r *AuthRedis) createMFAChallengeKey(token string) string {
+	return fmt.Sprintf("mfa_challenge:%s", token)
+}
+
+// RecordLoginFailureCtx adds a failed attempt to the sliding window and returns
+// the number of failures left in it.
+func (r *AuthRedis) RecordLoginFailureCtx(ctx context.Context, scope string, id string, window time.Duration) (int64, error) {
+	ctx, span := r.tracer.Start(ctx, "authRedis.RecordLoginFailureCtx")
+	defer span.End()
+
+	key := r.createLoginFailuresKey(scope, id)
+	now := time.Now()
+
+	pipe := r.client.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, key, "-inf", fmt.Sprint(now.Add(-window).UnixNano()))
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.UnixNano()), Member: now.UnixNano()})
+	count := pipe.ZCard(ctx, key)
+	pipe.Expire(ctx, key, window)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	return count.Val(), nil
+}
+
+// GetLoginFailuresCtx returns the number of failures in the sliding window and the time of the last one.
+func (r *AuthRedis) GetLoginFailuresCtx(ctx context.Context, scope string, id string, window time.Duration) (int64, time.Time, error) {
+	ctx, span := r.tracer.Start(ctx, "authRedis.GetLoginFailuresCtx")
+	defer span.End()
+
+	key := r.createLoginFailuresKey(scope, id)
+	from := fmt.Sprint(time.Now().Add(-window).UnixNano())
+
+	pipe := r.client.Pipeline()
+	count := pipe.ZCount(ctx, key, from, "+inf")
+	last := pipe.ZRevRangeWithScores(ctx, key, 0, 0)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, time.Time{}, err
+	}
+
+	var lastFailure time.Time
+	if len(last.Val()) > 0 {
+		lastFailure = time.Unix(0, int64(last.Val()[0].Score))
+	}
+
+	return count.Val(), lastFailure, nil
+}
+
+func (r *AuthRedis) ClearLoginFailuresCtx(ctx context.Context, scope string, id string) error {
+	ctx, span := r.tracer.Start(ctx, "authRedis.ClearLoginFailuresCtx")
+	defer span.End()
+
+	return r.client.Del(ctx, r.createLoginFailuresKey(scope, id)).Err()
+}
+
+// LockAccountCtx returns false if the account was already locked.
+func (r *AuthRedis) LockAccountCtx(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	ctx, span := r.tracer.Start(ctx, "authRedis.LockAccountCtx")
+	defer span.End()
+
+	return r.client.SetNX(ctx, r.createLockoutKey(id), 1, ttl).Result()
+}
+
+// GetAccountLockCtx returns how long the account stays locked, zero if it is not locked.
+func (r *AuthRedis) GetAccountLockCtx(ctx context.Context, id string) (time.Duration, error) {
+	ctx, span := r.tracer.Start(ctx, "authRedis.GetAccountLockCtx")
+	defer span.End()
+
+	ttl, err := r.client.PTTL(ctx, r.createLockoutKey(id)).Result()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if ttl < 0 {
+		return 0, nil
+	}
+
+	return ttl, nil
+}
+
+func (r *AuthRedis) createLoginFailuresKey(scope string, id string) string {
+	return fmt.Sprintf("login_failures:%s:%s", scope, id)
+}
+
+func (r *AuthRedis) createLockoutKey(id string) string {
+	return fmt.Sprintf("lockout:%s", id)
+}
+
+// UseGrantCtx returns false if the grant has already been used.
+func (r *AuthRedis) UseGrantCtx(ctx context.Context, grantID string, ttl time.Duration) (bool, error) {
+	ctx, span := r.tracer.Start(ctx, "authRedis.UseGrantCtx")
+	defer span.End()
+
+	return r.client.SetNX(ctx, r.createGrantUsedKey(grantID), 1, ttl).Result()
+}
+
+// ReleaseGrantCtx makes a grant claimed by UseGrantCtx usable again.
+func (r *AuthRedis) ReleaseGrantCtx(ctx context.Context, grantID string) error {
+	ctx, span := r.tracer.Start(ctx, "authRedis.ReleaseGrantCtx")
+	defer span.End()
+
+	return r.client.Del(ctx, r.createGrantUsedKey(grantID)).Err()
+}
+
+func (r *AuthRedis) createGrantUsedKey(grantID string) string {
+	return fmt.Sprintf("grant_used:%s", grantID)
+}
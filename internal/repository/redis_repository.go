@@ -3,10 +3,35 @@ package repository
 import (
 	"context"
 	"github.com/Verce11o/yata-auth/internal/domain"
+	"time"
 )
 
 type RedisRepository interface {
 	GetByIdCtx(ctx context.Context, key string) (*domain.User, error)
 	SetByIdCtx(ctx context.Context, key string, user *domain.User) error
 	DeleteUserCtx(ctx context.Context, key string) error
+
+	RevokeTokenCtx(ctx context.Context, tokenID string, ttl time.Duration) error
+	IsTokenRevokedCtx(ctx context.Context, tokenID string) (bool, error)
+	GetTokenVersionCtx(ctx context.Context, userID string) (int, bool, error)
+	SetTokenVersionCtx(ctx context.Context, userID string, version int, ttl time.Duration) error
+
+	GetSessionCtx(ctx context.Context, sessionID string) (*domain.Session, error)
+	SetSessionCtx(ctx context.Context, session *domain.Session) error
+	RevokeSessionsCtx(ctx context.Context, ttl time.Duration, sessionIDs ...string) error
+
+	SetMFAChallengeCtx(ctx context.Context, token string, challenge *domain.MFAChallenge, ttl time.Duration) error
+	TakeMFAChallengeCtx(ctx context.Context, token string) (*domain.MFAChallenge, time.Duration, error)
+	IncrMFAChallengeAttemptsCtx(ctx context.Context, token string, ttl time.Duration) (int64, error)
+	DeleteMFAChallengeCtx(ctx context.Context, token string) error
+	MarkTOTPUsedCtx(ctx context.Context, userID string, step int64, ttl time.Duration) (bool, error)
+
+	RecordLoginFailureCtx(ctx context.Context, scope string, id string, window time.Duration) (int64, error)
+	GetLoginFailuresCtx(ctx context.Context, scope string, id string, window time.Duration) (int64, time.Time, error)
+	ClearLoginFailuresCtx(ctx context.Context, scope string, id string) error
+	LockAccountCtx(ctx context.Context, id string, ttl time.Duration) (bool, error)
+	GetAccountLockCtx(ctx context.Context, id string) (time.Duration, error)
+
+	UseGrantCtx(ctx context.Context, grantID string, ttl time.Duration) (bool, error)
+	ReleaseGrantCtx(ctx context.Context, grantID string) error
 }
@@ -4,15 +4,48 @@ import (
 	"context"
 	"github.com/Verce11o/yata-auth/internal/domain"
 	pb "github.com/Verce11o/yata-protos/gen/go/sso"
+	"time"
 )
 
 type Repository interface { // maybe refactor to smaller interface?
-	Register(ctx context.Context, input *pb.RegisterRequest) (string, error)
-	GetUser(ctx context.Context, email string) (domain.User, error)
+	Register(ctx context.Context, input *pb.RegisterRequest, canonicalEmail string) (string, error)
+	GetUser(ctx context.Context, email string, canonicalEmail string) (domain.User, error)
 	GetUserByID(ctx context.Context, userID string) (domain.User, error)
 	UpdatePassword(ctx context.Context, userID string, password string) error
-	AddVerificationCode(ctx context.Context, codeType string, code string, userID string) error
-	GetVerificationCode(ctx context.Context, codeID string) (*domain.VerificationCode, error)
+	ResetPassword(ctx context.Context, userID string, password string, codeType string, historyDepth int) (int, []string, error)
+	ChangePassword(ctx context.Context, userID string, password string, historyDepth int, keepSessionID string, audit domain.AuditEvent, email []byte) (int, []string, error)
+	GetPasswordHistory(ctx context.Context, userID string, limit int) ([]string, error)
+	AddVerificationCode(ctx context.Context, code *domain.VerificationCode, email []byte) error
+	ConsumeVerificationCode(ctx context.Context, codeType string, codeHash string) (*domain.VerificationCode, error)
+	ConsumeUserVerificationCode(ctx context.Context, userID string, codeType string, codeHash string) (*domain.VerificationCode, error)
+	IncrUserVerificationCodeAttempts(ctx context.Context, userID string, codeType string) (int64, int, error)
+	InvalidateVerificationCode(ctx context.Context, id int64) error
 	ClearVerificationCode(ctx context.Context, userID string, codeType string) error
 	VerifyUser(ctx context.Context, userID string) (*domain.User, error)
+
+	CreateRefreshToken(ctx context.Context, token *domain.RefreshToken) error
+	GetRefreshToken(ctx context.Context, tokenHash string) (*domain.RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, oldTokenID string, token *domain.RefreshToken) error
+	GetTokenVersion(ctx context.Context, userID string) (int, error)
+	RevokeUserTokens(ctx context.Context, userID string) (int, []string, error)
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string, issuedAfter time.Time) ([]domain.RefreshToken, error)
+
+	CreateSession(ctx context.Context, session *domain.Session) error
+	GetSession(ctx context.Context, sessionID string) (*domain.Session, error)
+	GetUserSessions(ctx context.Context, userID string) ([]domain.Session, error)
+	TouchSession(ctx context.Context, sessionID string, expireDate time.Time) error
+	RevokeSession(ctx context.Context, userID string, sessionID string) error
+	RevokeOtherSessions(ctx context.Context, userID string, keepSessionID string) ([]string, error)
+
+	GetUserMFA(ctx context.Context, userID string) (*domain.UserMFA, error)
+	SaveUserMFASecret(ctx context.Context, userID string, secret string) error
+	EnableUserMFA(ctx context.Context, userID string, recoveryCodeHashes []string) error
+	ReplaceRecoveryCodes(ctx context.Context, userID string, recoveryCodeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userID string, codeHash string) error
+
+	AddOutboxMessage(ctx context.Context, payload []byte) error
+	ClaimOutbox(ctx context.Context, limit int, maxAttempts int, lease time.Duration) ([]domain.OutboxMessage, error)
+	DeleteOutboxMessage(ctx context.Context, id int64) error
+	RetryOutboxMessage(ctx context.Context, msg domain.OutboxMessage, lastError string) error
+	PurgeOutbox(ctx context.Context, createdBefore time.Time) (int64, error)
 }
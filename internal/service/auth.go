@@ -1,19 +1,23 @@
 package service
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"fmt"
+	"database/sql"
+	"errors"
+	"github.com/Verce11o/yata-auth/config"
 	"github.com/Verce11o/yata-auth/internal/domain"
 	"github.com/Verce11o/yata-auth/internal/lib/auth_jwt"
-	"github.com/Verce11o/yata-auth/internal/lib/email"
+	"github.com/Verce11o/yata-auth/internal/lib/emailaddr"
 	"github.com/Verce11o/yata-auth/internal/lib/grpc_errors"
+	"github.com/Verce11o/yata-auth/internal/lib/hasher"
+	"github.com/Verce11o/yata-auth/internal/lib/passwordpolicy"
+	"github.com/Verce11o/yata-auth/internal/lib/totp"
 	"github.com/Verce11o/yata-auth/internal/repository"
 	pb "github.com/Verce11o/yata-protos/gen/go/sso"
 	"github.com/google/uuid"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"sync"
 	"time"
 )
 
@@ -27,23 +31,71 @@ type AuthService struct {
 	tracer                trace.Tracer
 	repo                  repository.Repository
 	redis                 repository.RedisRepository
-	emailPublisher        email.EmailPublisher
 	emailEndpoint         string
 	passwordResetEndpoint string
-	jwtService            auth_jwt.JWTService
+	defaultLocale         string
+	codes                 config.CodesConfig
+	passwordPolicy        *passwordpolicy.Policy
+	recoveryCodeKey       []byte
+	emailNormalizer       *emailaddr.Normalizer
+	domainFilter          *emailaddr.DomainFilter
+	jwtService            *auth_jwt.JWTService
+	hasher                hasher.Hasher
+	totp                  *totp.TOTP
+	lockout               config.LockoutConfig
+	// dummyHash is verified for logins of unknown emails, see verifyDummyPassword.
+	dummyHash     string
+	dummyHashOnce sync.Once
 }
 
-func NewAuthService(log *zap.SugaredLogger, tracer trace.Tracer, repo repository.Repository, redis repository.RedisRepository, emailPublisher email.EmailPublisher, emailEndpoint string, passwordResetEndpoint string, jwtService auth_jwt.JWTService) *AuthService {
-	return &AuthService{log: log, tracer: tracer, repo: repo, redis: redis, emailPublisher: emailPublisher, emailEndpoint: emailEndpoint, passwordResetEndpoint: passwordResetEndpoint, jwtService: jwtService}
+func NewAuthService(log *zap.SugaredLogger, tracer trace.Tracer, repo repository.Repository, redis repository.RedisRepository, emailEndpoint string, passwordResetEndpoint string, defaultLocale string, codes config.CodesConfig, passwordPolicy *passwordpolicy.Policy, emailNormalizer *emailaddr.Normalizer, domainFilter *emailaddr.DomainFilter, jwtService *auth_jwt.JWTService, hasher hasher.Hasher, totp *totp.TOTP, recoveryCodeKey []byte, lockout config.LockoutConfig) *AuthService {
+	return &AuthService{log: log, tracer: tracer, repo: repo, redis: redis, emailEndpoint: emailEndpoint, passwordResetEndpoint: passwordResetEndpoint, defaultLocale: defaultLocale, codes: codes, passwordPolicy: passwordPolicy, emailNormalizer: emailNormalizer, domainFilter: domainFilter, jwtService: jwtService, hasher: hasher, totp: totp, recoveryCodeKey: recoveryCodeKey, lockout: lockout}
 }
 
 func (a *AuthService) Register(ctx context.Context, input *pb.RegisterRequest) (string, error) {
 	ctx, span := a.tracer.Start(ctx, "authService.Register")
 	defer span.End()
 
-	input.Password = a.jwtService.GenerateHashPassword(input.Password)
+	email, err := a.emailNormalizer.Normalize(input.GetEmail())
 
-	userID, err := a.repo.Register(ctx, input)
+	if err != nil {
+		return "", &grpc_errors.ValidationError{
+			Err:        grpc_errors.ErrInvalidArgument,
+			Violations: []grpc_errors.FieldViolation{{Field: "email", Description: "must be a valid email address"}},
+		}
+	}
+
+	input.Email = email
+
+	canonicalEmail, err := a.emailNormalizer.Canonical(email)
+
+	if err != nil {
+		return "", &grpc_errors.ValidationError{
+			Err:        grpc_errors.ErrInvalidArgument,
+			Violations: []grpc_errors.FieldViolation{{Field: "email", Description: "must be a valid email address"}},
+		}
+	}
+
+	if err := a.checkEmailDomain(ctx, email); err != nil {
+		return "", err
+	}
+
+	if err := a.checkPasswordPolicy("password", input.GetPassword(), passwordpolicy.UserInfo{
+		Username: input.GetUsername(),
+		Email:    input.GetEmail(),
+	}); err != nil {
+		return "", err
+	}
+
+	hashedPass, err := a.hasher.Hash(input.GetPassword())
+
+	if err != nil {
+		return "", err
+	}
+
+	input.Password = hashedPass
+
+	userID, err := a.repo.Register(ctx, input, canonicalEmail)
 
 	if err != nil {
 		return "", err
@@ -53,7 +105,7 @@ func (a *AuthService) Register(ctx context.Context, input *pb.RegisterRequest) (
 }
 
 // todo эта функуия = send email, нужна еще get code в которой будут проверки
-func (a *AuthService) VerifyUser(ctx context.Context, input *pb.VerifyRequest) error {
+func (a *AuthService) VerifyUser(ctx context.Context, input *pb.VerifyRequest, client domain.ClientInfo) error {
 	ctx, span := a.tracer.Start(ctx, "authService.VerifyUser")
 	defer span.End()
 
@@ -67,27 +119,19 @@ func (a *AuthService) VerifyUser(ctx context.Context, input *pb.VerifyRequest) e
 		return grpc_errors.ErrAlreadyVerified
 	}
 
-	code := uuid.NewString()
-
-	err = a.repo.AddVerificationCode(ctx, EmailCodeType, code, input.GetUserId())
+	code, variables, ttl, err := a.newVerificationCode(user.UserID, EmailCodeType, a.emailEndpoint)
 
 	if err != nil {
 		return err
 	}
 
-	SendEmailRequest := domain.SendUserEmailRequest{
-		Type: EmailCodeType,
-		To:   user.Email,
-		Code: fmt.Sprintf("%v?code=%v", a.emailEndpoint, code),
-	}
-
-	messageBytes, err := json.Marshal(SendEmailRequest)
+	messageBytes, err := a.newEmailEvent(ctx, domain.EmailEventVerification, &user, client, variables, ttl)
 
 	if err != nil {
 		return err
 	}
 
-	err = a.emailPublisher.Publish(ctx, messageBytes)
+	err = a.repo.AddVerificationCode(ctx, code, messageBytes)
 
 	if err != nil {
 		return err
@@ -101,21 +145,10 @@ func (a *AuthService) CheckVerify(ctx context.Context, input *pb.CheckVerifyRequ
 	ctx, span := a.tracer.Start(ctx, "authService.CheckVerify")
 	defer span.End()
 
-	code, err := a.repo.GetVerificationCode(ctx, input.GetCode())
-
-	if err != nil || code == nil {
-		a.log.Infof("cannot get verified code by id in postgres: %v", err.Error())
-		return grpc_errors.ErrGettingCode
-	}
+	code, err := a.consumeVerificationCode(ctx, EmailCodeType, input.GetUserId(), input.GetCode())
 
-	if code.Code.String() != input.GetCode() {
-		a.log.Infof("invalid code: %v and %v", code.Code.String(), input.GetCode())
-		return grpc_errors.ErrCodeInvalid
-	}
-
-	if time.Now().UTC().After(code.ExpireDate) {
-		a.log.Errorf("code is expired")
-		return grpc_errors.ErrCodeExpired
+	if err != nil {
+		return err
 	}
 
 	user, err := a.repo.VerifyUser(ctx, code.UserID.String())
@@ -143,29 +176,346 @@ func (a *AuthService) CheckVerify(ctx context.Context, input *pb.CheckVerifyRequ
 
 }
 
-func (a *AuthService) Login(ctx context.Context, input *pb.LoginRequest) (string, error) {
+func (a *AuthService) Login(ctx context.Context, input *pb.LoginRequest, client domain.ClientInfo) (domain.Tokens, error) {
 	ctx, span := a.tracer.Start(ctx, "authService.Login")
 	defer span.End()
 
-	input.Password = a.jwtService.GenerateHashPassword(input.GetPassword())
+	email, err := a.emailNormalizer.Normalize(input.GetEmail())
 
-	user, err := a.repo.GetUser(ctx, input.GetEmail())
+	if err != nil {
+		return domain.Tokens{}, grpc_errors.ErrInvalidCredentials
+	}
+
+	// failures are counted per mailbox, so dot and subaddress variants share the lockout
+	mailbox, err := a.emailNormalizer.Canonical(email)
 
 	if err != nil {
-		return "", err
+		mailbox = email
 	}
 
-	if !bytes.Equal([]byte(input.GetPassword()), user.PasswordHash) {
-		return "", grpc_errors.ErrInvalidCredentials
+	if err := a.checkLoginAllowed(ctx, mailbox, client.IP); err != nil {
+		return domain.Tokens{}, err
 	}
 
-	token, err := a.jwtService.GenerateToken(user.UserID.String())
+	user, err := a.repo.GetUser(ctx, email, mailbox)
+
+	// unknown emails fail like wrong passwords so registered emails cannot be enumerated
+	if errors.Is(err, sql.ErrNoRows) {
+		a.verifyDummyPassword(input.GetPassword())
+		a.recordLoginFailure(ctx, mailbox, client, nil)
+		return domain.Tokens{}, grpc_errors.ErrInvalidCredentials
+	}
 
 	if err != nil {
-		return "", err
+		return domain.Tokens{}, err
 	}
 
-	return token, nil
+	ok, err := a.hasher.Verify(input.GetPassword(), string(user.PasswordHash))
+
+	if err != nil {
+		a.log.Errorf("cannot verify user password: %v", err.Error())
+		a.recordLoginFailure(ctx, mailbox, client, &user)
+		return domain.Tokens{}, grpc_errors.ErrInvalidCredentials
+	}
+
+	if !ok {
+		a.recordLoginFailure(ctx, mailbox, client, &user)
+		return domain.Tokens{}, grpc_errors.ErrInvalidCredentials
+	}
+
+	a.clearLoginFailures(ctx, mailbox)
+
+	if a.hasher.NeedsRehash(string(user.PasswordHash)) {
+		a.rehashPassword(ctx, user.UserID.String(), input.GetPassword())
+	}
+
+	mfa, err := a.repo.GetUserMFA(ctx, user.UserID.String())
+
+	if err != nil && !errors.Is(err, grpc_errors.ErrNotFound) {
+		a.log.Errorf("cannot get user mfa: %v", err.Error())
+		return domain.Tokens{}, err
+	}
+
+	if mfa != nil && mfa.Enabled {
+		mfaToken, err := a.startMFAChallenge(ctx, user.UserID, client)
+
+		if err != nil {
+			return domain.Tokens{}, err
+		}
+
+		return domain.Tokens{MFAToken: mfaToken}, nil
+	}
+
+	session, err := a.createSession(ctx, user.UserID, client)
+
+	if err != nil {
+		a.log.Errorf("cannot create session: %v", err.Error())
+		return domain.Tokens{}, err
+	}
+
+	return a.issueTokens(ctx, user.UserID, session.SessionID)
+}
+
+func (a *AuthService) Refresh(ctx context.Context, input *pb.RefreshRequest) (domain.Tokens, error) {
+	ctx, span := a.tracer.Start(ctx, "authService.Refresh")
+	defer span.End()
+
+	token, err := a.repo.GetRefreshToken(ctx, auth_jwt.HashRefreshToken(input.GetRefreshToken()))
+
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+
+	if token.RevokedAt != nil && token.ReplacedBy == nil {
+		return domain.Tokens{}, grpc_errors.ErrInvalidRefreshToken
+	}
+
+	if token.RevokedAt != nil {
+		a.log.Warnf("refresh token reuse detected, revoking family %v", token.FamilyID.String())
+
+		if err := a.revokeRefreshTokenFamily(ctx, token.FamilyID.String()); err != nil {
+			return domain.Tokens{}, err
+		}
+
+		return domain.Tokens{}, grpc_errors.ErrRefreshTokenReused
+	}
+
+	if time.Now().UTC().After(token.ExpireDate) {
+		return domain.Tokens{}, grpc_errors.ErrInvalidRefreshToken
+	}
+
+	version, err := a.currentTokenVersion(ctx, token.UserID.String())
+
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+
+	accessToken, claims, err := a.jwtService.IssueToken(token.UserID.String(), token.FamilyID.String(), version)
+
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+
+	refreshToken, newToken, err := a.newRefreshToken(token.UserID, token.FamilyID, claims.ID)
+
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+
+	err = a.repo.RotateRefreshToken(ctx, token.TokenID.String(), newToken)
+
+	if errors.Is(err, grpc_errors.ErrRefreshTokenReused) {
+		a.log.Warnf("concurrent refresh token reuse detected, revoking family %v", token.FamilyID.String())
+
+		a.revokeRefreshTokenFamily(ctx, token.FamilyID.String())
+
+		return domain.Tokens{}, grpc_errors.ErrRefreshTokenReused
+	}
+
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+
+	if err := a.repo.TouchSession(ctx, token.FamilyID.String(), newToken.ExpireDate); err != nil {
+		a.log.Errorf("cannot update session last seen: %v", err.Error())
+	}
+
+	return domain.Tokens{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+// ValidateToken introspects an access token. Invalid, expired or revoked
+// tokens are reported as inactive rather than as an error.
+func (a *AuthService) ValidateToken(ctx context.Context, input *pb.ValidateTokenRequest) (domain.TokenIntrospection, error) {
+	ctx, span := a.tracer.Start(ctx, "authService.ValidateToken")
+	defer span.End()
+
+	claims, err := a.authenticate(ctx, input.GetToken())
+
+	if errors.Is(err, grpc_errors.ErrInvalidToken) {
+		return domain.TokenIntrospection{Active: false}, nil
+	}
+
+	if err != nil {
+		return domain.TokenIntrospection{}, err
+	}
+
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+
+	return domain.TokenIntrospection{
+		Active:    true,
+		UserID:    claims.UserID,
+		Scope:     claims.Scope,
+		TokenID:   claims.ID,
+		Issuer:    claims.Issuer,
+		Audience:  claims.Audience,
+		ExpiresAt: claims.ExpiresAt.Time,
+		IssuedAt:  issuedAt,
+	}, nil
+}
+
+// authenticate verifies an access token and makes sure neither the token nor
+// its session has been revoked.
+func (a *AuthService) authenticate(ctx context.Context, token string) (*auth_jwt.TokenClaims, error) {
+	ctx, span := a.tracer.Start(ctx, "authService.authenticate")
+	defer span.End()
+
+	claims, err := a.jwtService.ParseToken(token)
+
+	if err != nil {
+		a.log.Debugf("token is not valid: %v", err.Error())
+		return nil, grpc_errors.ErrInvalidToken
+	}
+
+	revoked, err := a.redis.IsTokenRevokedCtx(ctx, claims.ID)
+
+	if err != nil {
+		a.log.Errorf("cannot check token revocation in redis: %v", err.Error())
+		return nil, err
+	}
+
+	if revoked {
+		return nil, grpc_errors.ErrInvalidToken
+	}
+
+	version, err := a.currentTokenVersion(ctx, claims.UserID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, grpc_errors.ErrInvalidToken
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.TokenVersion != version {
+		return nil, grpc_errors.ErrInvalidToken
+	}
+
+	if claims.SessionID == "" {
+		return claims, nil
+	}
+
+	active, err := a.isSessionActive(ctx, claims.SessionID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !active {
+		return nil, grpc_errors.ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+// issueTokens creates an access token and a refresh token for the session, the
+// session ID doubles as the refresh token family ID.
+func (a *AuthService) issueTokens(ctx context.Context, userID uuid.UUID, sessionID uuid.UUID) (domain.Tokens, error) {
+	ctx, span := a.tracer.Start(ctx, "authService.issueTokens")
+	defer span.End()
+
+	version, err := a.currentTokenVersion(ctx, userID.String())
+
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+
+	accessToken, claims, err := a.jwtService.IssueToken(userID.String(), sessionID.String(), version)
+
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+
+	refreshToken, token, err := a.newRefreshToken(userID, sessionID, claims.ID)
+
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+
+	if err := a.repo.CreateRefreshToken(ctx, token); err != nil {
+		return domain.Tokens{}, err
+	}
+
+	return domain.Tokens{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+func (a *AuthService) newRefreshToken(userID uuid.UUID, familyID uuid.UUID, accessTokenID string) (string, *domain.RefreshToken, error) {
+	refreshToken, tokenHash, err := a.jwtService.GenerateRefreshToken()
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	accessID, err := uuid.Parse(accessTokenID)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	return refreshToken, &domain.RefreshToken{
+		TokenID:       uuid.New(),
+		FamilyID:      familyID,
+		UserID:        userID,
+		TokenHash:     tokenHash,
+		ExpireDate:    time.Now().UTC().Add(a.jwtService.RefreshTokenTTL()),
+		AccessTokenID: &accessID,
+	}, nil
+}
+
+// revokeRefreshTokenFamily revokes the family after a reuse was detected,
+// together with the access tokens issued with it that have not expired yet.
+func (a *AuthService) revokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	ctx, span := a.tracer.Start(ctx, "authService.revokeRefreshTokenFamily")
+	defer span.End()
+
+	ttl := a.jwtService.AccessTokenTTL()
+
+	tokens, err := a.repo.RevokeRefreshTokenFamily(ctx, familyID, time.Now().UTC().Add(-ttl))
+
+	if err != nil {
+		a.log.Errorf("cannot revoke refresh token family: %v", err.Error())
+		return err
+	}
+
+	for _, token := range tokens {
+		if err := a.redis.RevokeTokenCtx(ctx, token.AccessTokenID.String(), time.Until(token.CreatedAt.Add(ttl))); err != nil {
+			a.log.Errorf("cannot revoke access token in redis: %v", err.Error())
+		}
+	}
+
+	return nil
+}
+
+// revokeAccessToken puts the token on the revocation list until it expires.
+func (a *AuthService) revokeAccessToken(ctx context.Context, claims *auth_jwt.TokenClaims) {
+	if claims.ExpiresAt == nil {
+		return
+	}
+
+	if err := a.redis.RevokeTokenCtx(ctx, claims.ID, time.Until(claims.ExpiresAt.Time)); err != nil {
+		a.log.Errorf("cannot revoke access token in redis: %v", err.Error())
+	}
+}
+
+// rehashPassword upgrades an outdated password hash after a successful login.
+// Failures are only logged since the user has already been authenticated.
+func (a *AuthService) rehashPassword(ctx context.Context, userID string, password string) {
+	ctx, span := a.tracer.Start(ctx, "authService.rehashPassword")
+	defer span.End()
+
+	hashedPass, err := a.hasher.Hash(password)
+
+	if err != nil {
+		a.log.Errorf("cannot rehash user password: %v", err.Error())
+		return
+	}
+
+	if err := a.repo.UpdatePassword(ctx, userID, hashedPass); err != nil {
+		a.log.Errorf("cannot update rehashed user password: %v", err.Error())
+	}
 }
 
 func (a *AuthService) GetByUUID(ctx context.Context, userID string) (domain.User, error) {
@@ -196,7 +546,7 @@ func (a *AuthService) GetByUUID(ctx context.Context, userID string) (domain.User
 	return user, nil
 }
 
-func (a *AuthService) ForgotPassword(ctx context.Context, input *pb.ForgotPasswordRequest) error {
+func (a *AuthService) ForgotPassword(ctx context.Context, input *pb.ForgotPasswordRequest, client domain.ClientInfo) error {
 	ctx, span := a.tracer.Start(ctx, "authService.ForgotPassword")
 	defer span.End()
 
@@ -206,27 +556,19 @@ func (a *AuthService) ForgotPassword(ctx context.Context, input *pb.ForgotPasswo
 		return err
 	}
 
-	code := uuid.NewString()
-
-	err = a.repo.AddVerificationCode(ctx, PassCodeType, code, input.GetUserId())
+	code, variables, ttl, err := a.newVerificationCode(user.UserID, PassCodeType, a.passwordResetEndpoint)
 
 	if err != nil {
 		return err
 	}
 
-	SendEmailRequest := domain.SendUserEmailRequest{
-		Type: PassCodeType,
-		To:   user.Email,
-		Code: fmt.Sprintf("%v?code=%v", a.passwordResetEndpoint, code),
-	}
-
-	messageBytes, err := json.Marshal(SendEmailRequest)
+	messageBytes, err := a.newEmailEvent(ctx, domain.EmailEventPasswordReset, &user, client, variables, ttl)
 
 	if err != nil {
 		return err
 	}
 
-	err = a.emailPublisher.Publish(ctx, messageBytes)
+	err = a.repo.AddVerificationCode(ctx, code, messageBytes)
 
 	if err != nil {
 		return err
@@ -236,54 +578,98 @@ func (a *AuthService) ForgotPassword(ctx context.Context, input *pb.ForgotPasswo
 
 }
 
-func (a *AuthService) VerifyPassword(ctx context.Context, input *pb.VerifyPasswordRequest) error {
+// VerifyPassword consumes the reset code and returns a short-lived grant
+// that authorizes ResetPassword for the owner of the code.
+func (a *AuthService) VerifyPassword(ctx context.Context, input *pb.VerifyPasswordRequest) (string, error) {
 	ctx, span := a.tracer.Start(ctx, "authService.VerifyPassword")
 	defer span.End()
 
-	code, err := a.repo.GetVerificationCode(ctx, input.GetCode())
+	code, err := a.consumeVerificationCode(ctx, PassCodeType, input.GetUserId(), input.GetCode())
 
-	if err != nil || code == nil {
-		a.log.Infof("cannot get pass code by id in postgres: %v", err.Error())
-		return grpc_errors.ErrGettingCode
+	if err != nil {
+		return "", err
 	}
 
-	if code.Code.String() != input.GetCode() {
-		a.log.Infof("invalid code: %v and %v", code.Code.String(), input.GetCode())
-		return grpc_errors.ErrCodeInvalid
-	}
+	grant, err := a.jwtService.GenerateGrant(code.UserID.String(), auth_jwt.PasswordResetGrant, time.Duration(a.codes.ResetGrantTTLMinutes)*time.Minute)
 
-	if time.Now().UTC().After(code.ExpireDate) {
-		a.log.Errorf("code is expired")
-		return grpc_errors.ErrCodeExpired
+	if err != nil {
+		a.log.Errorf("cannot generate reset grant: %v", err.Error())
+		return "", err
 	}
 
-	return nil
+	return grant, nil
 }
+
 func (a *AuthService) ResetPassword(ctx context.Context, input *pb.ResetPasswordRequest) error {
 	ctx, span := a.tracer.Start(ctx, "authService.ResetPassword")
 	defer span.End()
 
+	grant, err := a.jwtService.ParseGrant(input.GetResetToken(), auth_jwt.PasswordResetGrant)
+
+	if err != nil {
+		a.log.Infof("invalid reset grant: %v", err.Error())
+		return grpc_errors.ErrInvalidToken
+	}
+
 	if input.GetPassword() != input.GetPasswordRe() {
 		a.log.Errorf("password mismatch")
 		return grpc_errors.ErrPasswordMismatch
 	}
 
-	hashedPass := a.jwtService.GenerateHashPassword(input.GetPassword())
+	user, err := a.repo.GetUserByID(ctx, grant.Subject)
+
+	if err != nil {
+		a.log.Errorf("cannot get user by id in postgres: %v", err.Error())
+		return err
+	}
+
+	if err := a.checkPasswordPolicy("password", input.GetPassword(), passwordpolicy.UserInfo{
+		Username: user.Username,
+		Email:    user.Email,
+	}); err != nil {
+		return err
+	}
+
+	if err := a.checkPasswordHistory(ctx, "password", grant.Subject, input.GetPassword()); err != nil {
+		return err
+	}
+
+	hashedPass, err := a.hasher.Hash(input.GetPassword())
 
-	err := a.repo.UpdatePassword(ctx, input.GetUserId(), hashedPass)
+	if err != nil {
+		return err
+	}
+
+	fresh, err := a.redis.UseGrantCtx(ctx, grant.ID, time.Until(grant.ExpiresAt.Time))
 
 	if err != nil {
-		a.log.Errorf("cannot update user password: %v", err.Error())
+		a.log.Errorf("cannot mark reset grant used in redis: %v", err.Error())
 		return err
 	}
 
-	err = a.repo.ClearVerificationCode(ctx, input.GetCode(), PassCodeType)
+	if !fresh {
+		return grpc_errors.ErrInvalidToken
+	}
+
+	version, sessionIDs, err := a.repo.ResetPassword(ctx, grant.Subject, hashedPass, PassCodeType, a.passwordPolicy.HistoryDepth())
 
 	if err != nil {
-		a.log.Errorf("cannot clear user codes")
+		a.log.Errorf("cannot reset user password: %v", err.Error())
+
+		// nothing was changed, so the user can retry with the same link
+		if err := a.redis.ReleaseGrantCtx(context.WithoutCancel(ctx), grant.ID); err != nil {
+			a.log.Errorf("cannot release reset grant in redis: %v", err.Error())
+		}
+
 		return err
 	}
 
+	a.tokensRevoked(ctx, grant.Subject, version, sessionIDs)
+
+	if err := a.redis.DeleteUserCtx(ctx, grant.Subject); err != nil {
+		a.log.Errorf("cannot delete user in redis: %v", err.Error())
+	}
+
 	return nil
 
 }
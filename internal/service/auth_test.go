@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/Verce11o/yata-auth/internal/domain"
+	"github.com/Verce11o/yata-auth/internal/lib/auth_jwt"
+	"github.com/Verce11o/yata-auth/internal/lib/grpc_errors"
+	pb "github.com/Verce11o/yata-protos/gen/go/sso"
+	"testing"
+	"time"
+)
+
+func TestRefreshRotatesToken(t *testing.T) {
+	a, repo, _ := newTestService(t)
+	addUser(t, a, repo, "user@example.com", "password123")
+
+	tokens := login(t, a, "user@example.com", "password123")
+
+	rotated, err := a.Refresh(context.Background(), &pb.RefreshRequest{RefreshToken: tokens.RefreshToken})
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	if rotated.RefreshToken == tokens.RefreshToken || rotated.AccessToken == "" {
+		t.Fatalf("Refresh() did not issue new tokens")
+	}
+
+	old, _ := repo.GetRefreshToken(context.Background(), auth_jwt.HashRefreshToken(tokens.RefreshToken))
+	if old.RevokedAt == nil || old.ReplacedBy == nil {
+		t.Errorf("old refresh token revoked_at = %v, replaced_by = %v, want both set", old.RevokedAt, old.ReplacedBy)
+	}
+
+	if _, err := a.Refresh(context.Background(), &pb.RefreshRequest{RefreshToken: rotated.RefreshToken}); err != nil {
+		t.Errorf("Refresh() with the rotated token: %v", err)
+	}
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	a, repo, redis := newTestService(t)
+	addUser(t, a, repo, "user@example.com", "password123")
+
+	tokens := login(t, a, "user@example.com", "password123")
+
+	rotated, err := a.Refresh(context.Background(), &pb.RefreshRequest{RefreshToken: tokens.RefreshToken})
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	if _, err := a.Refresh(context.Background(), &pb.RefreshRequest{RefreshToken: tokens.RefreshToken}); !errors.Is(err, grpc_errors.ErrRefreshTokenReused) {
+		t.Fatalf("Refresh() with a rotated token error = %v, want %v", err, grpc_errors.ErrRefreshTokenReused)
+	}
+
+	if _, err := a.Refresh(context.Background(), &pb.RefreshRequest{RefreshToken: rotated.RefreshToken}); !errors.Is(err, grpc_errors.ErrInvalidRefreshToken) {
+		t.Errorf("Refresh() after reuse error = %v, want %v", err, grpc_errors.ErrInvalidRefreshToken)
+	}
+
+	for _, accessToken := range []string{tokens.AccessToken, rotated.AccessToken} {
+		claims, err := a.jwtService.ParseToken(accessToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !redis.revokedTokens[claims.ID] {
+			t.Errorf("access token %v of the family was not revoked", claims.ID)
+		}
+	}
+}
+
+func TestRefreshInvalidToken(t *testing.T) {
+	a, repo, _ := newTestService(t)
+	addUser(t, a, repo, "user@example.com", "password123")
+
+	tokens := login(t, a, "user@example.com", "password123")
+
+	token, _ := repo.GetRefreshToken(context.Background(), auth_jwt.HashRefreshToken(tokens.RefreshToken))
+	repo.refreshTokens[token.TokenHash].ExpireDate = time.Now().UTC().Add(-time.Minute)
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "unknown", token: "unknown"},
+		{name: "expired", token: tokens.RefreshToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := a.Refresh(context.Background(), &pb.RefreshRequest{RefreshToken: tt.token}); !errors.Is(err, grpc_errors.ErrInvalidRefreshToken) {
+				t.Errorf("Refresh() error = %v, want %v", err, grpc_errors.ErrInvalidRefreshToken)
+			}
+		})
+	}
+}
+
+func TestValidateToken(t *testing.T) {
+	a, repo, redis := newTestService(t)
+	user := addUser(t, a, repo, "user@example.com", "password123")
+
+	tokens := login(t, a, "user@example.com", "password123")
+
+	claims, err := a.jwtService.ParseToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := a.ValidateToken(context.Background(), &pb.ValidateTokenRequest{Token: tokens.AccessToken})
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+
+	if !got.Active || got.UserID != user.UserID.String() || got.TokenID != claims.ID {
+		t.Errorf("ValidateToken() = %+v, want active token %v of user %v", got, claims.ID, user.UserID)
+	}
+
+	if got.ExpiresAt.IsZero() || got.IssuedAt.IsZero() {
+		t.Errorf("ValidateToken() exp = %v, iat = %v, want both set", got.ExpiresAt, got.IssuedAt)
+	}
+
+	redis.revokedTokens[claims.ID] = true
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "malformed", token: "not-a-jwt"},
+		{name: "revoked", token: tokens.AccessToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := a.ValidateToken(context.Background(), &pb.ValidateTokenRequest{Token: tt.token})
+			if err != nil {
+				t.Fatalf("ValidateToken: %v", err)
+			}
+
+			if got.Active {
+				t.Errorf("ValidateToken() = %+v, want inactive", got)
+			}
+		})
+	}
+}
+
+// resetGrant verifies a fresh otp of the user and returns the reset grant.
+func resetGrant(t *testing.T, a *AuthService, repo *fakeRepo, user domain.User) string {
+	t.Helper()
+
+	addOTP(t, repo, user, "123456", time.Minute)
+
+	grant, err := a.VerifyPassword(context.Background(), &pb.VerifyPasswordRequest{UserId: user.UserID.String(), Code: "123456"})
+	if err != nil {
+		t.Fatalf("VerifyPassword: %v", err)
+	}
+
+	return grant
+}
+
+func TestResetPassword(t *testing.T) {
+	a, repo, _ := newTestService(t)
+	user := addUser(t, a, repo, "user@example.com", "password123")
+
+	tokens := login(t, a, "user@example.com", "password123")
+	grant := resetGrant(t, a, repo, user)
+
+	if err := a.ResetPassword(context.Background(), &pb.ResetPasswordRequest{ResetToken: grant, Password: "new-password", PasswordRe: "new-password"}); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+
+	login(t, a, "user@example.com", "new-password")
+
+	if isActive(t, a, tokens.AccessToken) {
+		t.Errorf("access token issued before the reset is still active")
+	}
+
+	err := a.ResetPassword(context.Background(), &pb.ResetPasswordRequest{ResetToken: grant, Password: "other-password", PasswordRe: "other-password"})
+
+	if !errors.Is(err, grpc_errors.ErrInvalidToken) {
+		t.Errorf("ResetPassword() with a used grant error = %v, want %v", err, grpc_errors.ErrInvalidToken)
+	}
+}
+
+func TestResetPasswordReleasesGrantOnFailure(t *testing.T) {
+	a, repo, _ := newTestService(t)
+	user := addUser(t, a, repo, "user@example.com", "password123")
+
+	grant := resetGrant(t, a, repo, user)
+	input := &pb.ResetPasswordRequest{ResetToken: grant, Password: "new-password", PasswordRe: "new-password"}
+
+	repo.resetPasswordErr = errors.New("connection refused")
+
+	if err := a.ResetPassword(context.Background(), input); !errors.Is(err, repo.resetPasswordErr) {
+		t.Fatalf("ResetPassword() error = %v, want %v", err, repo.resetPasswordErr)
+	}
+
+	repo.resetPasswordErr = nil
+
+	if err := a.ResetPassword(context.Background(), input); err != nil {
+		t.Errorf("ResetPassword() retry with the same grant: %v", err)
+	}
+}
+
+func TestResetPasswordRejects(t *testing.T) {
+	a, repo, _ := newTestService(t)
+	user := addUser(t, a, repo, "user@example.com", "password123")
+
+	tokens := login(t, a, "user@example.com", "password123")
+	grant := resetGrant(t, a, repo, user)
+
+	tests := []struct {
+		name    string
+		input   *pb.ResetPasswordRequest
+		wantErr error
+	}{
+		{name: "malformed grant", input: &pb.ResetPasswordRequest{ResetToken: "not-a-jwt", Password: "new-password", PasswordRe: "new-password"}, wantErr: grpc_errors.ErrInvalidToken},
+		{name: "access token as grant", input: &pb.ResetPasswordRequest{ResetToken: tokens.AccessToken, Password: "new-password", PasswordRe: "new-password"}, wantErr: grpc_errors.ErrInvalidToken},
+		{name: "password mismatch", input: &pb.ResetPasswordRequest{ResetToken: grant, Password: "new-password", PasswordRe: "other-password"}, wantErr: grpc_errors.ErrPasswordMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := a.ResetPassword(context.Background(), tt.input); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ResetPassword() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := a.ResetPassword(context.Background(), &pb.ResetPasswordRequest{ResetToken: grant, Password: "new-password", PasswordRe: "new-password"}); err != nil {
+		t.Errorf("ResetPassword() after rejected attempts: %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Verce11o/yata-auth/internal/domain"
+	"github.com/Verce11o/yata-auth/internal/lib/grpc_errors"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+// newEmailEvent builds the outbox payload of an email to the user.
+// The renderer falls back to the default locale when there are no templates
+// for the locale of the client.
+func (a *AuthService) newEmailEvent(ctx context.Context, eventType string, user *domain.User, client domain.ClientInfo, variables map[string]string, ttl time.Duration) ([]byte, error) {
+	now := time.Now()
+
+	locale := client.Locale
+	if locale == "" {
+		locale = a.defaultLocale
+	}
+
+	event := domain.EmailEvent{
+		EventID:       uuid.New(),
+		EventType:     eventType,
+		SchemaVersion: domain.EmailEventSchemaVersion,
+		OccurredAt:    now,
+		CorrelationID: client.RequestID,
+		Recipient: domain.EmailRecipient{
+			Email:    user.Email,
+			Username: user.Username,
+			Locale:   locale,
+		},
+		Variables: variables,
+	}
+
+	if spanCtx := trace.SpanContextFromContext(ctx); spanCtx.HasTraceID() {
+		event.TraceID = spanCtx.TraceID().String()
+	}
+
+	if ttl > 0 {
+		expiresAt := now.Add(ttl)
+		event.ExpiresAt = &expiresAt
+	}
+
+	return json.Marshal(event)
+}
+
+// checkEmailDomain rejects registrations from blocked or disposable domains.
+// Lookup failures are logged and let the registration through.
+func (a *AuthService) checkEmailDomain(ctx context.Context, email string) error {
+	ctx, span := a.tracer.Start(ctx, "authService.checkEmailDomain")
+	defer span.End()
+
+	reason, err := a.domainFilter.Check(ctx, email)
+
+	if err != nil {
+		a.log.Warnf("cannot check email domain: %v", err.Error())
+	}
+
+	if reason == "" {
+		return nil
+	}
+
+	a.log.Infof("registration rejected, email domain %s", reason)
+
+	return &grpc_errors.ValidationError{
+		Err:        grpc_errors.ErrEmailDomainRejected,
+		Violations: []grpc_errors.FieldViolation{{Field: "email", Description: "email domain is not accepted"}},
+	}
+}
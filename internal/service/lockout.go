@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"github.com/Verce11o/yata-auth/internal/domain"
+	"github.com/Verce11o/yata-auth/internal/lib/grpc_errors"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+const (
+	accountScope = "account"
+	ipScope      = "ip"
+)
+
+// checkLoginAllowed rejects the attempt while the account is locked, the
+// source IP exceeded its failure budget or the back-off delay after the last
+// failure has not passed yet.
+func (a *AuthService) checkLoginAllowed(ctx context.Context, email string, ip string) error {
+	ctx, span := a.tracer.Start(ctx, "authService.checkLoginAllowed")
+	defer span.End()
+
+	account := lockoutAccountID(email)
+
+	locked, err := a.redis.GetAccountLockCtx(ctx, account)
+
+	if err != nil {
+		a.log.Errorf("cannot get account lock in redis: %v", err.Error())
+		return err
+	}
+
+	if locked > 0 {
+		return grpc_errors.ErrAccountLocked
+	}
+
+	if ip != "" {
+		failures, _, err := a.redis.GetLoginFailuresCtx(ctx, ipScope, ip, a.lockoutWindow())
+
+		if err != nil {
+			a.log.Errorf("cannot get ip login failures in redis: %v", err.Error())
+			return err
+		}
+
+		if failures >= int64(a.lockout.MaxIPFailures) {
+			return grpc_errors.ErrTooManyAttempts
+		}
+	}
+
+	failures, lastFailure, err := a.redis.GetLoginFailuresCtx(ctx, accountScope, account, a.lockoutWindow())
+
+	if err != nil {
+		a.log.Errorf("cannot get account login failures in redis: %v", err.Error())
+		return err
+	}
+
+	if failures > 0 && time.Now().Before(lastFailure.Add(a.backoffDelay(failures))) {
+		return grpc_errors.ErrTooManyAttempts
+	}
+
+	return nil
+}
+
+// recordLoginFailure counts the failed attempt and locks the account once it
+// reaches the configured threshold. user is nil if the email is unknown.
+func (a *AuthService) recordLoginFailure(ctx context.Context, email string, client domain.ClientInfo, user *domain.User) {
+	ctx, span := a.tracer.Start(ctx, "authService.recordLoginFailure")
+	defer span.End()
+
+	account := lockoutAccountID(email)
+
+	if client.IP != "" {
+		if _, err := a.redis.RecordLoginFailureCtx(ctx, ipScope, client.IP, a.lockoutWindow()); err != nil {
+			a.log.Errorf("cannot record ip login failure in redis: %v", err.Error())
+		}
+	}
+
+	failures, err := a.redis.RecordLoginFailureCtx(ctx, accountScope, account, a.lockoutWindow())
+
+	if err != nil {
+		a.log.Errorf("cannot record account login failure in redis: %v", err.Error())
+		return
+	}
+
+	if failures < int64(a.lockout.MaxAccountFailures) {
+		return
+	}
+
+	locked, err := a.redis.LockAccountCtx(ctx, account, time.Duration(a.lockout.LockoutMinutes)*time.Minute)
+
+	if err != nil {
+		a.log.Errorf("cannot lock account in redis: %v", err.Error())
+		return
+	}
+
+	if err := a.redis.ClearLoginFailuresCtx(ctx, accountScope, account); err != nil {
+		a.log.Errorf("cannot clear account login failures in redis: %v", err.Error())
+	}
+
+	if !locked || user == nil {
+		return
+	}
+
+	a.log.Warnf("account %v locked after %d failed login attempts", user.UserID.String(), failures)
+
+	if err := a.revokeAllTokens(ctx, user.UserID.String()); err != nil {
+		a.log.Errorf("cannot revoke tokens of locked account: %v", err.Error())
+	}
+
+	if err := a.sendLockoutEmail(ctx, user, client); err != nil {
+		a.log.Errorf("cannot send lockout email: %v", err.Error())
+	}
+}
+
+func (a *AuthService) clearLoginFailures(ctx context.Context, email string) {
+	if err := a.redis.ClearLoginFailuresCtx(ctx, accountScope, lockoutAccountID(email)); err != nil {
+		a.log.Errorf("cannot clear account login failures in redis: %v", err.Error())
+	}
+}
+
+func (a *AuthService) sendLockoutEmail(ctx context.Context, user *domain.User, client domain.ClientInfo) error {
+	messageBytes, err := a.newEmailEvent(ctx, domain.EmailEventAccountLocked, user, client, nil, time.Duration(a.lockout.LockoutMinutes)*time.Minute)
+
+	if err != nil {
+		return err
+	}
+
+	return a.repo.AddOutboxMessage(ctx, messageBytes)
+}
+
+// verifyDummyPassword spends the time of a password check on logins of
+// unknown emails, so the response time does not tell whether an account exists.
+func (a *AuthService) verifyDummyPassword(password string) {
+	a.dummyHashOnce.Do(func() {
+		hash, err := a.hasher.Hash(uuid.NewString())
+
+		if err != nil {
+			a.log.Errorf("cannot hash dummy password: %v", err.Error())
+			return
+		}
+
+		a.dummyHash = hash
+	})
+
+	if a.dummyHash == "" {
+		return
+	}
+
+	if _, err := a.hasher.Verify(password, a.dummyHash); err != nil {
+		a.log.Errorf("cannot verify dummy password: %v", err.Error())
+	}
+}
+
+// backoffDelay doubles the wait after every failure up to the configured maximum.
+func (a *AuthService) backoffDelay(failures int64) time.Duration {
+	maxDelay := time.Duration(a.lockout.MaxDelaySeconds) * time.Second
+	delay := time.Duration(a.lockout.BaseDelayMillis) * time.Millisecond
+
+	for i := int64(1); i < failures; i++ {
+		delay *= 2
+		if delay >= maxDelay {
+			return maxDelay
+		}
+	}
+
+	return delay
+}
+
+func (a *AuthService) lockoutWindow() time.Duration {
+	return time.Duration(a.lockout.WindowMinutes) * time.Minute
+}
+
+// lockoutAccountID keys counters by email so unknown accounts are throttled the same way.
+func lockoutAccountID(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Verce11o/yata-auth/internal/domain"
+	"github.com/Verce11o/yata-auth/internal/lib/grpc_errors"
+	pb "github.com/Verce11o/yata-protos/gen/go/sso"
+	"testing"
+	"time"
+)
+
+func failLogin(t *testing.T, a *AuthService, email string, client domain.ClientInfo) {
+	t.Helper()
+
+	_, err := a.Login(context.Background(), &pb.LoginRequest{Email: email, Password: "wrong-password"}, client)
+
+	if !errors.Is(err, grpc_errors.ErrInvalidCredentials) {
+		t.Fatalf("Login() with a wrong password error = %v, want %v", err, grpc_errors.ErrInvalidCredentials)
+	}
+}
+
+func TestLoginLocksAccount(t *testing.T) {
+	a, repo, _ := newTestService(t)
+	addUser(t, a, repo, "user@example.com", "password123")
+
+	tokens := login(t, a, "user@example.com", "password123")
+	outbox := len(repo.outbox)
+
+	for i := 0; i < a.lockout.MaxAccountFailures; i++ {
+		failLogin(t, a, "user@example.com", domain.ClientInfo{})
+	}
+
+	_, err := a.Login(context.Background(), &pb.LoginRequest{Email: "user@example.com", Password: "password123"}, domain.ClientInfo{})
+
+	if !errors.Is(err, grpc_errors.ErrAccountLocked) {
+		t.Fatalf("Login() of a locked account error = %v, want %v", err, grpc_errors.ErrAccountLocked)
+	}
+
+	if isActive(t, a, tokens.AccessToken) {
+		t.Errorf("access token is still active after the account was locked")
+	}
+
+	if len(repo.outbox) != outbox+1 {
+		t.Errorf("%d emails queued, want the lockout email", len(repo.outbox)-outbox)
+	}
+}
+
+func TestLoginLocksUnknownEmail(t *testing.T) {
+	a, _, _ := newTestService(t)
+
+	for i := 0; i < a.lockout.MaxAccountFailures; i++ {
+		failLogin(t, a, "unknown@example.com", domain.ClientInfo{})
+	}
+
+	if a.dummyHash == "" {
+		t.Errorf("login of an unknown email did not verify a dummy hash")
+	}
+
+	_, err := a.Login(context.Background(), &pb.LoginRequest{Email: "unknown@example.com", Password: "password123"}, domain.ClientInfo{})
+
+	if !errors.Is(err, grpc_errors.ErrAccountLocked) {
+		t.Errorf("Login() of a locked unknown email error = %v, want %v", err, grpc_errors.ErrAccountLocked)
+	}
+}
+
+func TestLoginFailureWindow(t *testing.T) {
+	a, repo, redis := newTestService(t)
+	addUser(t, a, repo, "user@example.com", "password123")
+
+	expired := time.Now().Add(-a.lockoutWindow() - time.Minute)
+	key := accountScope + ":" + lockoutAccountID("user@example.com")
+
+	for i := 1; i < a.lockout.MaxAccountFailures; i++ {
+		redis.failures[key] = append(redis.failures[key], expired)
+	}
+
+	failLogin(t, a, "user@example.com", domain.ClientInfo{})
+
+	login(t, a, "user@example.com", "password123")
+
+	if len(redis.failures[key]) != 0 {
+		t.Errorf("failures were not cleared after a successful login")
+	}
+}
+
+func TestLoginIPBudget(t *testing.T) {
+	a, repo, _ := newTestService(t)
+	addUser(t, a, repo, "user@example.com", "password123")
+
+	client := domain.ClientInfo{IP: "10.0.0.1"}
+
+	for i := 0; i < a.lockout.MaxIPFailures; i++ {
+		failLogin(t, a, fmt.Sprintf("unknown%d@example.com", i), client)
+	}
+
+	_, err := a.Login(context.Background(), &pb.LoginRequest{Email: "user@example.com", Password: "password123"}, client)
+
+	if !errors.Is(err, grpc_errors.ErrTooManyAttempts) {
+		t.Errorf("Login() from an IP over budget error = %v, want %v", err, grpc_errors.ErrTooManyAttempts)
+	}
+}
+
+func TestLoginBackoff(t *testing.T) {
+	a, repo, _ := newTestService(t)
+	addUser(t, a, repo, "user@example.com", "password123")
+
+	a.lockout.BaseDelayMillis = 60000
+	a.lockout.MaxDelaySeconds = 600
+
+	failLogin(t, a, "user@example.com", domain.ClientInfo{})
+
+	_, err := a.Login(context.Background(), &pb.LoginRequest{Email: "user@example.com", Password: "password123"}, domain.ClientInfo{})
+
+	if !errors.Is(err, grpc_errors.ErrTooManyAttempts) {
+		t.Errorf("Login() within the back-off delay error = %v, want %v", err, grpc_errors.ErrTooManyAttempts)
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	a := &AuthService{}
+	a.lockout.BaseDelayMillis = 100
+	a.lockout.MaxDelaySeconds = 1
+
+	tests := []struct {
+		failures int64
+		want     time.Duration
+	}{
+		{failures: 1, want: 100 * time.Millisecond},
+		{failures: 2, want: 200 * time.Millisecond},
+		{failures: 4, want: 800 * time.Millisecond},
+		{failures: 5, want: time.Second},
+		{failures: 64, want: time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := a.backoffDelay(tt.failures); got != tt.want {
+			t.Errorf("backoffDelay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"github.com/Verce11o/yata-auth/internal/domain"
+	"github.com/Verce11o/yata-auth/internal/lib/auth_jwt"
+	"github.com/Verce11o/yata-auth/internal/lib/grpc_errors"
+	pb "github.com/Verce11o/yata-protos/gen/go/sso"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+const (
+	mfaChallengeTTL    = 5 * time.Minute
+	maxMFAAttempts     = 5
+	recoveryCodesCount = 10
+	// recoveryCodeBytes gives 80 bits of entropy, 16 base32 characters
+	recoveryCodeBytes = 10
+	recoveryCodeGroup = 4
+	// usedTOTPTTL covers every time step a code is accepted in
+	usedTOTPTTL = 2 * time.Minute
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func (a *AuthService) EnrollTOTP(ctx context.Context, accessToken string) (domain.MFAEnrollment, error) {
+	ctx, span := a.tracer.Start(ctx, "authService.EnrollTOTP")
+	defer span.End()
+
+	claims, err := a.authenticate(ctx, accessToken)
+
+	if err != nil {
+		return domain.MFAEnrollment{}, err
+	}
+
+	user, err := a.GetByUUID(ctx, claims.UserID)
+
+	if err != nil {
+		return domain.MFAEnrollment{}, err
+	}
+
+	secret, err := a.totp.GenerateSecret()
+
+	if err != nil {
+		return domain.MFAEnrollment{}, err
+	}
+
+	encryptedSecret, err := a.totp.Encrypt(secret)
+
+	if err != nil {
+		a.log.Errorf("cannot encrypt totp secret: %v", err.Error())
+		return domain.MFAEnrollment{}, err
+	}
+
+	if err := a.repo.SaveUserMFASecret(ctx, claims.UserID, encryptedSecret); err != nil {
+		return domain.MFAEnrollment{}, err
+	}
+
+	return domain.MFAEnrollment{
+		Secret:     secret,
+		OtpauthURI: a.totp.URI(user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables MFA once the user proves the authenticator app is set up
+// and returns the initial recovery codes.
+func (a *AuthService) ConfirmTOTP(ctx context.Context, accessToken string, input *pb.ConfirmTOTPRequest) ([]string, error) {
+	ctx, span := a.tracer.Start(ctx, "authService.ConfirmTOTP")
+	defer span.End()
+
+	claims, err := a.authenticate(ctx, accessToken)
+
+	if err != nil {
+		return nil, err
+	}
+
+	mfa, err := a.getUserMFA(ctx, claims.UserID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if mfa.Enabled {
+		return nil, grpc_errors.ErrMFAAlreadyEnabled
+	}
+
+	if err := a.validateTOTP(ctx, mfa, input.GetCode()); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := a.generateRecoveryCodes()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.repo.EnableUserMFA(ctx, claims.UserID, hashes); err != nil {
+		a.log.Errorf("cannot enable user mfa: %v", err.Error())
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// VerifyMFA redeems the challenge token returned by Login with a TOTP or recovery code.
+func (a *AuthService) VerifyMFA(ctx context.Context, input *pb.VerifyMFARequest) (domain.Tokens, error) {
+	ctx, span := a.tracer.Start(ctx, "authService.VerifyMFA")
+	defer span.End()
+
+	challenge, ttl, err := a.redis.TakeMFAChallengeCtx(ctx, input.GetMfaToken())
+
+	if err != nil {
+		a.log.Errorf("cannot get mfa challenge in redis: %v", err.Error())
+		return domain.Tokens{}, err
+	}
+
+	if challenge == nil {
+		return domain.Tokens{}, grpc_errors.ErrInvalidToken
+	}
+
+	userID := challenge.UserID.String()
+
+	if input.GetRecoveryCode() != "" {
+		err = a.repo.UseRecoveryCode(ctx, userID, a.hashRecoveryCode(input.GetRecoveryCode()))
+	} else {
+		var mfa *domain.UserMFA
+		mfa, err = a.getUserMFA(ctx, userID)
+		if err == nil {
+			err = a.validateTOTP(ctx, mfa, input.GetCode())
+		}
+	}
+
+	if errors.Is(err, grpc_errors.ErrInvalidMFACode) {
+		attempts, incrErr := a.redis.IncrMFAChallengeAttemptsCtx(ctx, input.GetMfaToken(), mfaChallengeTTL)
+
+		if incrErr != nil {
+			a.log.Errorf("cannot count mfa attempts in redis: %v", incrErr.Error())
+		}
+
+		if incrErr != nil || attempts >= maxMFAAttempts {
+			if err := a.redis.DeleteMFAChallengeCtx(ctx, input.GetMfaToken()); err != nil {
+				a.log.Errorf("cannot delete mfa challenge in redis: %v", err.Error())
+			}
+		} else {
+			a.restoreMFAChallenge(ctx, input.GetMfaToken(), challenge, ttl)
+		}
+
+		return domain.Tokens{}, err
+	}
+
+	if err != nil {
+		a.restoreMFAChallenge(ctx, input.GetMfaToken(), challenge, ttl)
+		return domain.Tokens{}, err
+	}
+
+	if err := a.redis.DeleteMFAChallengeCtx(ctx, input.GetMfaToken()); err != nil {
+		a.log.Errorf("cannot delete mfa challenge attempts in redis: %v", err.Error())
+	}
+
+	session, err := a.createSession(ctx, challenge.UserID, challenge.Client)
+
+	if err != nil {
+		a.log.Errorf("cannot create session: %v", err.Error())
+		return domain.Tokens{}, err
+	}
+
+	return a.issueTokens(ctx, challenge.UserID, session.SessionID)
+}
+
+// restoreMFAChallenge puts a taken challenge back for its remaining lifetime
+// so the user can retry.
+func (a *AuthService) restoreMFAChallenge(ctx context.Context, token string, challenge *domain.MFAChallenge, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	if err := a.redis.SetMFAChallengeCtx(ctx, token, challenge, ttl); err != nil {
+		a.log.Errorf("cannot restore mfa challenge in redis: %v", err.Error())
+	}
+}
+
+func (a *AuthService) RegenerateRecoveryCodes(ctx context.Context, accessToken string, input *pb.RegenerateRecoveryCodesRequest) ([]string, error) {
+	ctx, span := a.tracer.Start(ctx, "authService.RegenerateRecoveryCodes")
+	defer span.End()
+
+	claims, err := a.authenticate(ctx, accessToken)
+
+	if err != nil {
+		return nil, err
+	}
+
+	mfa, err := a.getUserMFA(ctx, claims.UserID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !mfa.Enabled {
+		return nil, grpc_errors.ErrMFANotEnabled
+	}
+
+	if err := a.validateTOTP(ctx, mfa, input.GetCode()); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := a.generateRecoveryCodes()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.repo.ReplaceRecoveryCodes(ctx, claims.UserID, hashes); err != nil {
+		a.log.Errorf("cannot replace recovery codes: %v", err.Error())
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// startMFAChallenge returns the token the client has to present together with
+// the second factor to finish the login.
+func (a *AuthService) startMFAChallenge(ctx context.Context, userID uuid.UUID, client domain.ClientInfo) (string, error) {
+	ctx, span := a.tracer.Start(ctx, "authService.startMFAChallenge")
+	defer span.End()
+
+	token, err := auth_jwt.GenerateOpaqueToken()
+
+	if err != nil {
+		return "", err
+	}
+
+	challenge := &domain.MFAChallenge{UserID: userID, Client: client}
+
+	if err := a.redis.SetMFAChallengeCtx(ctx, token, challenge, mfaChallengeTTL); err != nil {
+		a.log.Errorf("cannot set mfa challenge in redis: %v", err.Error())
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (a *AuthService) getUserMFA(ctx context.Context, userID string) (*domain.UserMFA, error) {
+	mfa, err := a.repo.GetUserMFA(ctx, userID)
+
+	if errors.Is(err, grpc_errors.ErrNotFound) {
+		return nil, grpc_errors.ErrMFANotEnabled
+	}
+
+	if err != nil {
+		a.log.Errorf("cannot get user mfa: %v", err.Error())
+		return nil, err
+	}
+
+	return mfa, nil
+}
+
+func (a *AuthService) validateTOTP(ctx context.Context, mfa *domain.UserMFA, code string) error {
+	secret, err := a.totp.Decrypt(mfa.Secret)
+
+	if err != nil {
+		a.log.Errorf("cannot decrypt totp secret: %v", err.Error())
+		return err
+	}
+
+	step, ok := a.totp.Validate(secret, code, time.Now())
+
+	if !ok {
+		return grpc_errors.ErrInvalidMFACode
+	}
+
+	first, err := a.redis.MarkTOTPUsedCtx(ctx, mfa.UserID.String(), step, usedTOTPTTL)
+
+	if err != nil {
+		a.log.Errorf("cannot mark totp code as used in redis: %v", err.Error())
+		return err
+	}
+
+	if !first {
+		return grpc_errors.ErrInvalidMFACode
+	}
+
+	return nil
+}
+
+// generateRecoveryCodes returns the codes shown to the user and the digests that are persisted.
+func (a *AuthService) generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodesCount)
+	hashes := make([]string, 0, recoveryCodesCount)
+
+	for i := 0; i < recoveryCodesCount; i++ {
+		b := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+
+		encoded := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+
+		groups := make([]string, 0, len(encoded)/recoveryCodeGroup)
+		for j := 0; j < len(encoded); j += recoveryCodeGroup {
+			groups = append(groups, encoded[j:j+recoveryCodeGroup])
+		}
+
+		code := strings.Join(groups, "-")
+
+		codes = append(codes, code)
+		hashes = append(hashes, a.hashRecoveryCode(code))
+	}
+
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode keys the digest with a server secret, so leaked digests
+// cannot be brute-forced offline.
+func (a *AuthService) hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+
+	mac := hmac.New(sha256.New, a.recoveryCodeKey)
+	mac.Write([]byte(normalized))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
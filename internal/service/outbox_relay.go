@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Verce11o/yata-auth/internal/domain"
+	"github.com/Verce11o/yata-auth/internal/lib/email"
+	"github.com/Verce11o/yata-auth/internal/repository"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"time"
+)
+
+// OutboxRelay publishes emails written to the outbox table. A message is
+// removed only after the broker accepted it, so consumers must tolerate
+// duplicates. Messages that are not delivered within the retention period
+// are purged.
+type OutboxRelay struct {
+	log            *zap.SugaredLogger
+	tracer         trace.Tracer
+	repo           repository.Repository
+	emailPublisher email.EmailPublisher
+	interval       time.Duration
+	batchSize      int
+	maxAttempts    int
+	lease          time.Duration
+	retention      time.Duration
+	purgeInterval  time.Duration
+}
+
+func NewOutboxRelay(log *zap.SugaredLogger, tracer trace.Tracer, repo repository.Repository, emailPublisher email.EmailPublisher, interval time.Duration, batchSize int, maxAttempts int, lease time.Duration, retention time.Duration, purgeInterval time.Duration) *OutboxRelay {
+	return &OutboxRelay{log: log, tracer: tracer, repo: repo, emailPublisher: emailPublisher, interval: interval, batchSize: batchSize, maxAttempts: maxAttempts, lease: lease, retention: retention, purgeInterval: purgeInterval}
+}
+
+// Run polls and purges the outbox until ctx is cancelled.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	purgeTicker := time.NewTicker(r.purgeInterval)
+	defer purgeTicker.Stop()
+
+	r.purge(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.relay(ctx)
+		case <-purgeTicker.C:
+			r.purge(ctx)
+		}
+	}
+}
+
+func (r *OutboxRelay) purge(ctx context.Context) {
+	ctx, span := r.tracer.Start(ctx, "outboxRelay.purge")
+	defer span.End()
+
+	purged, err := r.repo.PurgeOutbox(ctx, time.Now().Add(-r.retention))
+
+	if err != nil {
+		r.log.Errorf("cannot purge email outbox: %v", err.Error())
+		return
+	}
+
+	if purged > 0 {
+		r.log.Infof("purged %d undelivered email(s) from the outbox", purged)
+	}
+}
+
+func (r *OutboxRelay) relay(ctx context.Context) {
+	for {
+		delivered, err := r.processBatch(ctx)
+
+		if err != nil {
+			r.log.Errorf("cannot process email outbox: %v", err.Error())
+			return
+		}
+
+		// keep draining while full batches are delivered
+		if delivered < r.batchSize {
+			return
+		}
+	}
+}
+
+func (r *OutboxRelay) processBatch(ctx context.Context) (int, error) {
+	ctx, span := r.tracer.Start(ctx, "outboxRelay.processBatch")
+	defer span.End()
+
+	messages, err := r.repo.ClaimOutbox(ctx, r.batchSize, r.maxAttempts, r.lease)
+
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+
+	for _, msg := range messages {
+		if err := r.relayMessage(ctx, msg); err != nil {
+			if err := r.repo.RetryOutboxMessage(ctx, msg, err.Error()); err != nil {
+				return delivered, err
+			}
+
+			continue
+		}
+
+		if err := r.repo.DeleteOutboxMessage(ctx, msg.ID); err != nil {
+			return delivered, err
+		}
+
+		delivered++
+	}
+
+	return delivered, nil
+}
+
+func (r *OutboxRelay) relayMessage(ctx context.Context, msg domain.OutboxMessage) error {
+	ctx, span := r.tracer.Start(r.messageContext(ctx, msg), "outboxRelay.relayMessage",
+		trace.WithLinks(trace.Link{SpanContext: trace.SpanContextFromContext(ctx)}))
+	defer span.End()
+
+	event, err := email.DecodeEvent(msg.Payload)
+	if err != nil {
+		r.log.Errorf("cannot decode outbox message %d: %v", msg.ID, err.Error())
+		return err
+	}
+
+	if err := r.emailPublisher.Publish(ctx, event); err != nil {
+		r.log.Errorf("cannot publish outbox message %d (attempt %d): %v", msg.ID, msg.Attempts+1, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// messageContext restores the trace of the request that enqueued the message,
+// the batch span stays linked to the message span.
+func (r *OutboxRelay) messageContext(ctx context.Context, msg domain.OutboxMessage) context.Context {
+	if len(msg.TraceContext) == 0 {
+		return ctx
+	}
+
+	carrier := propagation.MapCarrier{}
+
+	if err := json.Unmarshal(msg.TraceContext, &carrier); err != nil {
+		r.log.Warnf("cannot decode trace context of outbox message %d: %v", msg.ID, err.Error())
+		return ctx
+	}
+
+	return propagation.TraceContext{}.Extract(ctx, carrier)
+}
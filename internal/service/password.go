@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"github.com/Verce11o/yata-auth/internal/domain"
+	"github.com/Verce11o/yata-auth/internal/lib/grpc_errors"
+	"github.com/Verce11o/yata-auth/internal/lib/passwordpolicy"
+	pb "github.com/Verce11o/yata-protos/gen/go/sso"
+)
+
+// ChangePassword replaces the password of the caller after checking the
+// current one. Every other session is revoked, the calling session is kept
+// and gets a new access token.
+func (a *AuthService) ChangePassword(ctx context.Context, accessToken string, input *pb.ChangePasswordRequest, client domain.ClientInfo) (string, error) {
+	ctx, span := a.tracer.Start(ctx, "authService.ChangePassword")
+	defer span.End()
+
+	claims, err := a.authenticate(ctx, accessToken)
+
+	if err != nil {
+		return "", err
+	}
+
+	user, err := a.repo.GetUserByID(ctx, claims.UserID)
+
+	if err != nil {
+		a.log.Errorf("cannot get user by id in postgres: %v", err.Error())
+		return "", err
+	}
+
+	ok, err := a.hasher.Verify(input.GetCurrentPassword(), string(user.PasswordHash))
+
+	if err != nil {
+		a.log.Errorf("cannot verify user password: %v", err.Error())
+		return "", grpc_errors.ErrInvalidCredentials
+	}
+
+	if !ok {
+		return "", grpc_errors.ErrInvalidCredentials
+	}
+
+	if input.GetNewPassword() != input.GetNewPasswordRe() {
+		return "", grpc_errors.ErrPasswordMismatch
+	}
+
+	if err := a.checkPasswordPolicy("new_password", input.GetNewPassword(), passwordpolicy.UserInfo{
+		Username: user.Username,
+		Email:    user.Email,
+	}); err != nil {
+		return "", err
+	}
+
+	if err := a.checkPasswordHistory(ctx, "new_password", claims.UserID, input.GetNewPassword()); err != nil {
+		return "", err
+	}
+
+	hashedPass, err := a.hasher.Hash(input.GetNewPassword())
+
+	if err != nil {
+		return "", err
+	}
+
+	messageBytes, err := a.newEmailEvent(ctx, domain.EmailEventPasswordChanged, &user, client, map[string]string{
+		"user_agent": client.UserAgent,
+		"ip":         client.IP,
+	}, 0)
+
+	if err != nil {
+		return "", err
+	}
+
+	audit := domain.AuditEvent{
+		UserID:    user.UserID,
+		Event:     domain.AuditPasswordChanged,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+	}
+
+	version, sessionIDs, err := a.repo.ChangePassword(ctx, claims.UserID, hashedPass, a.passwordPolicy.HistoryDepth(), claims.SessionID, audit, messageBytes)
+
+	if err != nil {
+		a.log.Errorf("cannot change user password: %v", err.Error())
+		return "", err
+	}
+
+	a.tokensRevoked(ctx, claims.UserID, version, sessionIDs)
+
+	if err := a.redis.DeleteUserCtx(ctx, claims.UserID); err != nil {
+		a.log.Errorf("cannot delete user in redis: %v", err.Error())
+	}
+
+	return a.jwtService.GenerateToken(claims.UserID, claims.SessionID, version)
+}
+
+// checkPasswordPolicy validates a new password against the configured policy
+// and reports every violated rule against the given request field.
+func (a *AuthService) checkPasswordPolicy(field string, password string, user passwordpolicy.UserInfo) error {
+	violations, err := a.passwordPolicy.Check(password, user)
+
+	if err != nil {
+		a.log.Errorf("cannot check password policy: %v", err.Error())
+		return err
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+
+	fieldViolations := make([]grpc_errors.FieldViolation, 0, len(violations))
+	for _, v := range violations {
+		fieldViolations = append(fieldViolations, grpc_errors.FieldViolation{Field: field, Description: v.Description})
+	}
+
+	return &grpc_errors.ValidationError{Err: grpc_errors.ErrWeakPassword, Violations: fieldViolations}
+}
+
+// checkPasswordHistory rejects a password matching one of the recent hashes
+// of the user, the comparison goes through the hasher so older algorithms
+// are still recognized.
+func (a *AuthService) checkPasswordHistory(ctx context.Context, field string, userID string, password string) error {
+	ctx, span := a.tracer.Start(ctx, "authService.checkPasswordHistory")
+	defer span.End()
+
+	depth := a.passwordPolicy.HistoryDepth()
+
+	if depth <= 0 {
+		return nil
+	}
+
+	hashes, err := a.repo.GetPasswordHistory(ctx, userID, depth)
+
+	if err != nil {
+		a.log.Errorf("cannot get password history in postgres: %v", err.Error())
+		return err
+	}
+
+	for _, hash := range hashes {
+		ok, err := a.hasher.Verify(password, hash)
+
+		if err != nil {
+			a.log.Errorf("cannot verify password history entry: %v", err.Error())
+			continue
+		}
+
+		if ok {
+			return &grpc_errors.ValidationError{
+				Err:        grpc_errors.ErrPasswordReused,
+				Violations: []grpc_errors.FieldViolation{{Field: field, Description: "password was used recently"}},
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/Verce11o/yata-auth/config"
+	"github.com/Verce11o/yata-auth/internal/domain"
+	"github.com/Verce11o/yata-auth/internal/lib/grpc_errors"
+	"github.com/Verce11o/yata-auth/internal/lib/hasher"
+	"github.com/Verce11o/yata-auth/internal/lib/passwordpolicy"
+	"github.com/Verce11o/yata-auth/internal/repository"
+	pb "github.com/Verce11o/yata-protos/gen/go/sso"
+	"go.opentelemetry.io/otel/trace/noop"
+	"go.uber.org/zap"
+	"testing"
+)
+
+// historyRepo serves a fixed password history, other repository methods are
+// not used by the history check.
+type historyRepo struct {
+	repository.Repository
+	hashes []string
+	err    error
+	limit  int
+	calls  int
+}
+
+func (r *historyRepo) GetPasswordHistory(ctx context.Context, userID string, limit int) ([]string, error) {
+	r.calls++
+	r.limit = limit
+	return r.hashes, r.err
+}
+
+func TestCheckPasswordHistory(t *testing.T) {
+	h, err := hasher.NewPasswordHasher(testHasherConfig, "salt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := func(password string) string {
+		encoded, err := h.Hash(password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return encoded
+	}
+
+	legacy, _ := hasher.NewLegacyHasher("salt").Hash("legacy-password")
+	repoErr := errors.New("connection refused")
+
+	tests := []struct {
+		name     string
+		depth    int
+		password string
+		hashes   []string
+		repoErr  error
+		wantErr  error
+		wantCall bool
+	}{
+		{name: "disabled", depth: 0, password: "old-password", hashes: []string{hash("old-password")}},
+		{name: "not reused", depth: 3, password: "new-password", hashes: []string{hash("old-password"), hash("older-password")}, wantCall: true},
+		{name: "reused", depth: 3, password: "older-password", hashes: []string{hash("old-password"), hash("older-password")}, wantErr: grpc_errors.ErrPasswordReused, wantCall: true},
+		{name: "reused legacy hash", depth: 3, password: "legacy-password", hashes: []string{legacy}, wantErr: grpc_errors.ErrPasswordReused, wantCall: true},
+		{name: "invalid entry is skipped", depth: 3, password: "old-password", hashes: []string{"$argon2id$broken", hash("old-password")}, wantErr: grpc_errors.ErrPasswordReused, wantCall: true},
+		{name: "empty history", depth: 3, password: "old-password", wantCall: true},
+		{name: "repository error", depth: 3, password: "old-password", repoErr: repoErr, wantErr: repoErr, wantCall: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := passwordpolicy.NewPolicy(config.PasswordPolicyConfig{HistoryDepth: tt.depth}, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			repo := &historyRepo{hashes: tt.hashes, err: tt.repoErr}
+
+			a := &AuthService{
+				log:            zap.NewNop().Sugar(),
+				tracer:         noop.NewTracerProvider().Tracer(""),
+				repo:           repo,
+				passwordPolicy: policy,
+				hasher:         h,
+			}
+
+			err = a.checkPasswordHistory(context.Background(), "new_password", "user-id", tt.password)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("checkPasswordHistory() error = %v, want %v", err, tt.wantErr)
+			}
+
+			var validationErr *grpc_errors.ValidationError
+			if errors.As(err, &validationErr) && validationErr.Violations[0].Field != "new_password" {
+				t.Errorf("violation field = %q, want new_password", validationErr.Violations[0].Field)
+			}
+
+			if (repo.calls > 0) != tt.wantCall {
+				t.Errorf("repository called %d times, want call %v", repo.calls, tt.wantCall)
+			}
+
+			if tt.wantCall && repo.limit != tt.depth {
+				t.Errorf("history limit = %d, want %d", repo.limit, tt.depth)
+			}
+		})
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	a, repo, _ := newTestService(t)
+	addUser(t, a, repo, "user@example.com", "password123")
+
+	current, other := loginTwice(t, a)
+	outbox := len(repo.outbox)
+
+	accessToken, err := a.ChangePassword(context.Background(), current.AccessToken, &pb.ChangePasswordRequest{CurrentPassword: "password123", NewPassword: "new-password", NewPasswordRe: "new-password"}, domain.ClientInfo{})
+	if err != nil {
+		t.Fatalf("ChangePassword: %v", err)
+	}
+
+	if repo.keptSessionID != sessionID(t, a, current.AccessToken) {
+		t.Errorf("kept session = %v, want the calling session", repo.keptSessionID)
+	}
+
+	if len(repo.outbox) != outbox+1 {
+		t.Errorf("%d emails queued, want the password changed email", len(repo.outbox)-outbox)
+	}
+
+	if !isActive(t, a, accessToken) {
+		t.Errorf("access token returned by ChangePassword is not active")
+	}
+
+	if sessionID(t, a, accessToken) != sessionID(t, a, current.AccessToken) {
+		t.Errorf("access token returned by ChangePassword belongs to another session")
+	}
+
+	for name, token := range map[string]string{"current": current.AccessToken, "other": other.AccessToken} {
+		if isActive(t, a, token) {
+			t.Errorf("old access token of the %s session is still active", name)
+		}
+	}
+
+	if _, err := a.Refresh(context.Background(), &pb.RefreshRequest{RefreshToken: current.RefreshToken}); err != nil {
+		t.Errorf("Refresh() of the calling session: %v", err)
+	}
+
+	if _, err := a.Refresh(context.Background(), &pb.RefreshRequest{RefreshToken: other.RefreshToken}); !errors.Is(err, grpc_errors.ErrInvalidRefreshToken) {
+		t.Errorf("Refresh() of the other session error = %v, want %v", err, grpc_errors.ErrInvalidRefreshToken)
+	}
+
+	login(t, a, "user@example.com", "new-password")
+}
+
+func TestChangePasswordRejects(t *testing.T) {
+	a, repo, _ := newTestService(t)
+	addUser(t, a, repo, "user@example.com", "password123")
+
+	tokens := login(t, a, "user@example.com", "password123")
+
+	accessToken, err := a.ChangePassword(context.Background(), tokens.AccessToken, &pb.ChangePasswordRequest{CurrentPassword: "password123", NewPassword: "new-password", NewPasswordRe: "new-password"}, domain.ClientInfo{})
+	if err != nil {
+		t.Fatalf("ChangePassword: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		accessToken string
+		input       *pb.ChangePasswordRequest
+		wantErr     error
+	}{
+		{name: "revoked token", accessToken: tokens.AccessToken, input: &pb.ChangePasswordRequest{CurrentPassword: "new-password", NewPassword: "other-password", NewPasswordRe: "other-password"}, wantErr: grpc_errors.ErrInvalidToken},
+		{name: "wrong current password", accessToken: accessToken, input: &pb.ChangePasswordRequest{CurrentPassword: "password123", NewPassword: "other-password", NewPasswordRe: "other-password"}, wantErr: grpc_errors.ErrInvalidCredentials},
+		{name: "mismatch", accessToken: accessToken, input: &pb.ChangePasswordRequest{CurrentPassword: "new-password", NewPassword: "other-password", NewPasswordRe: "another-password"}, wantErr: grpc_errors.ErrPasswordMismatch},
+		{name: "weak", accessToken: accessToken, input: &pb.ChangePasswordRequest{CurrentPassword: "new-password", NewPassword: "short", NewPasswordRe: "short"}, wantErr: grpc_errors.ErrWeakPassword},
+		{name: "reused", accessToken: accessToken, input: &pb.ChangePasswordRequest{CurrentPassword: "new-password", NewPassword: "new-password", NewPasswordRe: "new-password"}, wantErr: grpc_errors.ErrPasswordReused},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := a.ChangePassword(context.Background(), tt.accessToken, tt.input, domain.ClientInfo{})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ChangePassword() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
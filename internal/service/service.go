@@ -8,13 +8,26 @@ import (
 
 type Auth interface {
 	Register(ctx context.Context, input *pb.RegisterRequest) (string, error)
-	VerifyUser(ctx context.Context, input *pb.VerifyRequest) error
+	VerifyUser(ctx context.Context, input *pb.VerifyRequest, client domain.ClientInfo) error
 	CheckVerify(ctx context.Context, input *pb.CheckVerifyRequest) error
 
-	ForgotPassword(ctx context.Context, input *pb.ForgotPasswordRequest) error
-	VerifyPassword(ctx context.Context, input *pb.VerifyPasswordRequest) error
+	ForgotPassword(ctx context.Context, input *pb.ForgotPasswordRequest, client domain.ClientInfo) error
+	VerifyPassword(ctx context.Context, input *pb.VerifyPasswordRequest) (string, error)
 	ResetPassword(ctx context.Context, input *pb.ResetPasswordRequest) error
+	ChangePassword(ctx context.Context, accessToken string, input *pb.ChangePasswordRequest, client domain.ClientInfo) (string, error)
 
-	Login(ctx context.Context, input *pb.LoginRequest) (string, error)
+	Login(ctx context.Context, input *pb.LoginRequest, client domain.ClientInfo) (domain.Tokens, error)
+	Refresh(ctx context.Context, input *pb.RefreshRequest) (domain.Tokens, error)
+	ValidateToken(ctx context.Context, input *pb.ValidateTokenRequest) (domain.TokenIntrospection, error)
 	GetByUUID(ctx context.Context, userID string) (domain.User, error)
+
+	ListSessions(ctx context.Context, accessToken string) ([]domain.Session, error)
+	RevokeSession(ctx context.Context, accessToken string, input *pb.RevokeSessionRequest) error
+	RevokeOtherSessions(ctx context.Context, accessToken string) error
+	RevokeAllSessions(ctx context.Context, accessToken string) error
+
+	EnrollTOTP(ctx context.Context, accessToken string) (domain.MFAEnrollment, error)
+	ConfirmTOTP(ctx context.Context, accessToken string, input *pb.ConfirmTOTPRequest) ([]string, error)
+	VerifyMFA(ctx context.Context, input *pb.VerifyMFARequest) (domain.Tokens, error)
+	RegenerateRecoveryCodes(ctx context.Context, accessToken string, input *pb.RegenerateRecoveryCodesRequest) ([]string, error)
 }
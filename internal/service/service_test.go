@@ -0,0 +1,734 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"github.com/Verce11o/yata-auth/config"
+	"github.com/Verce11o/yata-auth/internal/domain"
+	"github.com/Verce11o/yata-auth/internal/lib/auth_jwt"
+	"github.com/Verce11o/yata-auth/internal/lib/emailaddr"
+	"github.com/Verce11o/yata-auth/internal/lib/grpc_errors"
+	"github.com/Verce11o/yata-auth/internal/lib/hasher"
+	"github.com/Verce11o/yata-auth/internal/lib/passwordpolicy"
+	"github.com/Verce11o/yata-auth/internal/repository"
+	pb "github.com/Verce11o/yata-protos/gen/go/sso"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace/noop"
+	"go.uber.org/zap"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testHasherConfig = config.HasherConfig{
+	Algorithm: hasher.Argon2idAlgorithm,
+	Argon2id:  config.Argon2idConfig{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32},
+}
+
+// newTestService wires an AuthService to in-memory fakes of postgres and
+// redis. Lockout back-off is disabled so tests can fail logins back to back.
+func newTestService(t *testing.T) (*AuthService, *fakeRepo, *fakeRedis) {
+	t.Helper()
+
+	h, err := hasher.NewPasswordHasher(testHasherConfig, "salt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := passwordpolicy.NewPolicy(config.PasswordPolicyConfig{MinLength: 8, MaxLength: 128, HistoryDepth: 3}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwtService, err := auth_jwt.MakeJWTService(config.JWTConfig{Secret: "secret", AccessTokenTTLMinutes: 15, RefreshTokenTTLHours: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := newFakeRepo()
+	redis := newFakeRedis()
+
+	a := NewAuthService(zap.NewNop().Sugar(), noop.NewTracerProvider().Tracer(""), repo, redis, "http://localhost/verify", "http://localhost/reset", "en",
+		config.CodesConfig{
+			Email:                config.CodeConfig{Format: domain.CodeFormatLink, LinkTTLMinutes: 60, OTPTTLMinutes: 10, OTPLength: 6, MaxAttempts: 3},
+			Password:             config.CodeConfig{Format: domain.CodeFormatOTP, LinkTTLMinutes: 60, OTPTTLMinutes: 10, OTPLength: 6, MaxAttempts: 3},
+			ResetGrantTTLMinutes: 15,
+		},
+		policy, emailaddr.NewNormalizer(config.EmailNormalizationConfig{}), nil, jwtService, h, nil, []byte("recovery-key"),
+		config.LockoutConfig{MaxAccountFailures: 3, MaxIPFailures: 10, WindowMinutes: 15, LockoutMinutes: 15})
+
+	return a, repo, redis
+}
+
+// addUser stores a verified user with the given password.
+func addUser(t *testing.T, a *AuthService, repo *fakeRepo, email string, password string) domain.User {
+	t.Helper()
+
+	hash, err := a.hasher.Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := domain.User{
+		UserID:       uuid.New(),
+		Username:     "user",
+		Email:        email,
+		PasswordHash: []byte(hash),
+		IsVerified:   true,
+	}
+
+	repo.mu.Lock()
+	repo.users[user.UserID] = user
+	repo.mu.Unlock()
+
+	return user
+}
+
+// fakeRepo keeps users, tokens, sessions and codes in memory with the same
+// semantics as the postgres repository. Methods no test needs are left to the
+// embedded nil interface.
+type fakeRepo struct {
+	repository.Repository
+
+	mu            sync.Mutex
+	users         map[uuid.UUID]domain.User
+	refreshTokens map[string]*domain.RefreshToken
+	sessions      map[string]*domain.Session
+	codes         []*domain.VerificationCode
+	history       map[string][]string
+	outbox        [][]byte
+
+	resetPasswordErr error
+	keptSessionID    string
+}
+
+func newFakeRepo() *fakeRepo {
+	return &fakeRepo{
+		users:         make(map[uuid.UUID]domain.User),
+		refreshTokens: make(map[string]*domain.RefreshToken),
+		sessions:      make(map[string]*domain.Session),
+		history:       make(map[string][]string),
+	}
+}
+
+func (r *fakeRepo) GetUser(ctx context.Context, email string, canonicalEmail string) (domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, user := range r.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+
+	return domain.User{}, sql.ErrNoRows
+}
+
+func (r *fakeRepo) GetUserByID(ctx context.Context, userID string) (domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return domain.User{}, sql.ErrNoRows
+	}
+
+	user, ok := r.users[id]
+	if !ok {
+		return domain.User{}, sql.ErrNoRows
+	}
+
+	return user, nil
+}
+
+func (r *fakeRepo) UpdatePassword(ctx context.Context, userID string, password string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user := r.users[uuid.MustParse(userID)]
+	user.PasswordHash = []byte(password)
+	r.users[user.UserID] = user
+
+	return nil
+}
+
+func (r *fakeRepo) ResetPassword(ctx context.Context, userID string, password string, codeType string, historyDepth int) (int, []string, error) {
+	if r.resetPasswordErr != nil {
+		return 0, nil, r.resetPasswordErr
+	}
+
+	return r.changePassword(userID, password, historyDepth, "")
+}
+
+func (r *fakeRepo) ChangePassword(ctx context.Context, userID string, password string, historyDepth int, keepSessionID string, audit domain.AuditEvent, email []byte) (int, []string, error) {
+	r.mu.Lock()
+	r.keptSessionID = keepSessionID
+	r.outbox = append(r.outbox, email)
+	r.mu.Unlock()
+
+	return r.changePassword(userID, password, historyDepth, keepSessionID)
+}
+
+func (r *fakeRepo) changePassword(userID string, password string, historyDepth int, keepSessionID string) (int, []string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[uuid.MustParse(userID)]
+	if !ok {
+		return 0, nil, sql.ErrNoRows
+	}
+
+	user.PasswordHash = []byte(password)
+	r.users[user.UserID] = user
+
+	history := append([]string{password}, r.history[userID]...)
+	if len(history) > historyDepth {
+		history = history[:historyDepth]
+	}
+	r.history[userID] = history
+
+	version, sessionIDs := r.revokeUserTokens(userID, keepSessionID)
+
+	return version, sessionIDs, nil
+}
+
+func (r *fakeRepo) GetPasswordHistory(ctx context.Context, userID string, limit int) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	history := r.history[userID]
+	if len(history) > limit {
+		history = history[:limit]
+	}
+
+	return history, nil
+}
+
+func (r *fakeRepo) AddVerificationCode(ctx context.Context, code *domain.VerificationCode, email []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	code.ID = int64(len(r.codes) + 1)
+	r.codes = append(r.codes, code)
+	r.outbox = append(r.outbox, email)
+
+	return nil
+}
+
+func (r *fakeRepo) ConsumeUserVerificationCode(ctx context.Context, userID string, codeType string, codeHash string) (*domain.VerificationCode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, code := range r.codes {
+		if code.UserID.String() == userID && code.Type == codeType && code.Format == domain.CodeFormatOTP && code.CodeHash == codeHash {
+			r.codes = append(r.codes[:i], r.codes[i+1:]...)
+			return code, nil
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+func (r *fakeRepo) IncrUserVerificationCodeAttempts(ctx context.Context, userID string, codeType string) (int64, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, code := range r.codes {
+		if code.UserID.String() == userID && code.Type == codeType && code.Format == domain.CodeFormatOTP {
+			code.Attempts++
+			return code.ID, code.Attempts, nil
+		}
+	}
+
+	return 0, 0, sql.ErrNoRows
+}
+
+func (r *fakeRepo) InvalidateVerificationCode(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, code := range r.codes {
+		if code.ID == id {
+			r.codes = append(r.codes[:i], r.codes[i+1:]...)
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (r *fakeRepo) CreateRefreshToken(ctx context.Context, token *domain.RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token.CreatedAt = time.Now().UTC()
+	r.refreshTokens[token.TokenHash] = token
+
+	return nil
+}
+
+func (r *fakeRepo) GetRefreshToken(ctx context.Context, tokenHash string) (*domain.RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.refreshTokens[tokenHash]
+	if !ok {
+		return nil, grpc_errors.ErrInvalidRefreshToken
+	}
+
+	copied := *token
+
+	return &copied, nil
+}
+
+func (r *fakeRepo) RotateRefreshToken(ctx context.Context, oldTokenID string, token *domain.RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, old := range r.refreshTokens {
+		if old.TokenID.String() != oldTokenID {
+			continue
+		}
+
+		if old.RevokedAt != nil {
+			return grpc_errors.ErrRefreshTokenReused
+		}
+
+		now := time.Now().UTC()
+		old.RevokedAt = &now
+		old.ReplacedBy = &token.TokenID
+
+		token.CreatedAt = now
+		r.refreshTokens[token.TokenHash] = token
+
+		return nil
+	}
+
+	return grpc_errors.ErrRefreshTokenReused
+}
+
+func (r *fakeRepo) GetTokenVersion(ctx context.Context, userID string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[uuid.MustParse(userID)]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+
+	return user.TokenVersion, nil
+}
+
+func (r *fakeRepo) RevokeUserTokens(ctx context.Context, userID string) (int, []string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	version, sessionIDs := r.revokeUserTokens(userID, "")
+
+	return version, sessionIDs, nil
+}
+
+// revokeUserTokens must be called with mu held.
+func (r *fakeRepo) revokeUserTokens(userID string, keepSessionID string) (int, []string) {
+	user := r.users[uuid.MustParse(userID)]
+	user.TokenVersion++
+	r.users[user.UserID] = user
+
+	now := time.Now().UTC()
+
+	var sessionIDs []string
+
+	for id, session := range r.sessions {
+		if session.UserID.String() == userID && id != keepSessionID && session.RevokedAt == nil {
+			session.RevokedAt = &now
+			sessionIDs = append(sessionIDs, id)
+		}
+	}
+
+	for _, token := range r.refreshTokens {
+		if token.UserID.String() == userID && token.FamilyID.String() != keepSessionID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+
+	return user.TokenVersion, sessionIDs
+}
+
+func (r *fakeRepo) RevokeRefreshTokenFamily(ctx context.Context, familyID string, issuedAfter time.Time) ([]domain.RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+
+	var tokens []domain.RefreshToken
+
+	for _, token := range r.refreshTokens {
+		if token.FamilyID.String() != familyID {
+			continue
+		}
+
+		if token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+
+		if token.CreatedAt.After(issuedAfter) && token.AccessTokenID != nil {
+			tokens = append(tokens, *token)
+		}
+	}
+
+	return tokens, nil
+}
+
+func (r *fakeRepo) CreateSession(ctx context.Context, session *domain.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	session.CreatedAt = now
+	session.LastSeenAt = now
+
+	copied := *session
+	r.sessions[session.SessionID.String()] = &copied
+
+	return nil
+}
+
+func (r *fakeRepo) GetSession(ctx context.Context, sessionID string) (*domain.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, ok := r.sessions[sessionID]
+	if !ok {
+		return nil, grpc_errors.ErrNotFound
+	}
+
+	copied := *session
+
+	return &copied, nil
+}
+
+func (r *fakeRepo) GetUserSessions(ctx context.Context, userID string) ([]domain.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var sessions []domain.Session
+
+	for _, session := range r.sessions {
+		if session.UserID.String() == userID && session.IsActive() {
+			sessions = append(sessions, *session)
+		}
+	}
+
+	return sessions, nil
+}
+
+func (r *fakeRepo) TouchSession(ctx context.Context, sessionID string, expireDate time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if session, ok := r.sessions[sessionID]; ok && session.RevokedAt == nil {
+		session.LastSeenAt = time.Now().UTC()
+		session.ExpireDate = expireDate
+	}
+
+	return nil
+}
+
+func (r *fakeRepo) RevokeSession(ctx context.Context, userID string, sessionID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, ok := r.sessions[sessionID]
+	if !ok || session.UserID.String() != userID || session.RevokedAt != nil {
+		return grpc_errors.ErrNotFound
+	}
+
+	now := time.Now().UTC()
+	session.RevokedAt = &now
+
+	for _, token := range r.refreshTokens {
+		if token.FamilyID.String() == sessionID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+
+	return nil
+}
+
+func (r *fakeRepo) RevokeOtherSessions(ctx context.Context, userID string, keepSessionID string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+
+	var sessionIDs []string
+
+	for id, session := range r.sessions {
+		if session.UserID.String() == userID && id != keepSessionID && session.RevokedAt == nil {
+			session.RevokedAt = &now
+			sessionIDs = append(sessionIDs, id)
+		}
+	}
+
+	for _, token := range r.refreshTokens {
+		if token.UserID.String() == userID && token.FamilyID.String() != keepSessionID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+
+	return sessionIDs, nil
+}
+
+func (r *fakeRepo) GetUserMFA(ctx context.Context, userID string) (*domain.UserMFA, error) {
+	return nil, grpc_errors.ErrNotFound
+}
+
+func (r *fakeRepo) AddOutboxMessage(ctx context.Context, payload []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.outbox = append(r.outbox, payload)
+
+	return nil
+}
+
+// fakeRedis keeps the caches, revocation lists and lockout counters in memory.
+// TTLs are ignored except for login failures, which are counted within the
+// window like the redis sorted sets.
+type fakeRedis struct {
+	repository.RedisRepository
+
+	mu              sync.Mutex
+	users           map[string]domain.User
+	revokedTokens   map[string]bool
+	tokenVersions   map[string]int
+	sessions        map[string]domain.Session
+	revokedSessions map[string]bool
+	failures        map[string][]time.Time
+	locks           map[string]time.Time
+	usedGrants      map[string]bool
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{
+		users:           make(map[string]domain.User),
+		revokedTokens:   make(map[string]bool),
+		tokenVersions:   make(map[string]int),
+		sessions:        make(map[string]domain.Session),
+		revokedSessions: make(map[string]bool),
+		failures:        make(map[string][]time.Time),
+		locks:           make(map[string]time.Time),
+		usedGrants:      make(map[string]bool),
+	}
+}
+
+func (r *fakeRedis) GetByIdCtx(ctx context.Context, key string) (*domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[key]
+	if !ok {
+		return nil, nil
+	}
+
+	return &user, nil
+}
+
+func (r *fakeRedis) SetByIdCtx(ctx context.Context, key string, user *domain.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.users[key] = *user
+
+	return nil
+}
+
+func (r *fakeRedis) DeleteUserCtx(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.users, key)
+
+	return nil
+}
+
+func (r *fakeRedis) RevokeTokenCtx(ctx context.Context, tokenID string, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.revokedTokens[tokenID] = true
+
+	return nil
+}
+
+func (r *fakeRedis) IsTokenRevokedCtx(ctx context.Context, tokenID string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.revokedTokens[tokenID], nil
+}
+
+func (r *fakeRedis) GetTokenVersionCtx(ctx context.Context, userID string) (int, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	version, ok := r.tokenVersions[userID]
+
+	return version, ok, nil
+}
+
+func (r *fakeRedis) SetTokenVersionCtx(ctx context.Context, userID string, version int, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if current, ok := r.tokenVersions[userID]; ok && current >= version {
+		return nil
+	}
+
+	r.tokenVersions[userID] = version
+
+	return nil
+}
+
+func (r *fakeRedis) GetSessionCtx(ctx context.Context, sessionID string) (*domain.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, ok := r.sessions[sessionID]
+	if !ok {
+		return nil, nil
+	}
+
+	return &session, nil
+}
+
+func (r *fakeRedis) SetSessionCtx(ctx context.Context, session *domain.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.revokedSessions[session.SessionID.String()] {
+		r.sessions[session.SessionID.String()] = *session
+	}
+
+	return nil
+}
+
+func (r *fakeRedis) RevokeSessionsCtx(ctx context.Context, ttl time.Duration, sessionIDs ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, sessionID := range sessionIDs {
+		r.revokedSessions[sessionID] = true
+		delete(r.sessions, sessionID)
+	}
+
+	return nil
+}
+
+func (r *fakeRedis) RecordLoginFailureCtx(ctx context.Context, scope string, id string, window time.Duration) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := scope + ":" + id
+	r.failures[key] = append(r.failures[key], time.Now())
+
+	count, _ := r.countFailures(key, window)
+
+	return count, nil
+}
+
+func (r *fakeRedis) GetLoginFailuresCtx(ctx context.Context, scope string, id string, window time.Duration) (int64, time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count, last := r.countFailures(scope+":"+id, window)
+
+	return count, last, nil
+}
+
+// countFailures must be called with mu held.
+func (r *fakeRedis) countFailures(key string, window time.Duration) (int64, time.Time) {
+	var count int64
+	var last time.Time
+
+	for _, at := range r.failures[key] {
+		if time.Since(at) > window {
+			continue
+		}
+
+		count++
+		if at.After(last) {
+			last = at
+		}
+	}
+
+	return count, last
+}
+
+func (r *fakeRedis) ClearLoginFailuresCtx(ctx context.Context, scope string, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.failures, scope+":"+id)
+
+	return nil
+}
+
+func (r *fakeRedis) LockAccountCtx(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if until, ok := r.locks[id]; ok && time.Now().Before(until) {
+		return false, nil
+	}
+
+	r.locks[id] = time.Now().Add(ttl)
+
+	return true, nil
+}
+
+func (r *fakeRedis) GetAccountLockCtx(ctx context.Context, id string) (time.Duration, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	until, ok := r.locks[id]
+	if !ok || time.Now().After(until) {
+		return 0, nil
+	}
+
+	return time.Until(until), nil
+}
+
+func (r *fakeRedis) UseGrantCtx(ctx context.Context, grantID string, ttl time.Duration) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.usedGrants[grantID] {
+		return false, nil
+	}
+
+	r.usedGrants[grantID] = true
+
+	return true, nil
+}
+
+func (r *fakeRedis) ReleaseGrantCtx(ctx context.Context, grantID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.usedGrants, grantID)
+
+	return nil
+}
+
+// login signs the user in from a fixed client and returns the issued tokens.
+func login(t *testing.T, a *AuthService, email string, password string) domain.Tokens {
+	t.Helper()
+
+	tokens, err := a.Login(context.Background(), &pb.LoginRequest{Email: email, Password: password}, domain.ClientInfo{UserAgent: "test", IP: "127.0.0.1"})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	return tokens
+}
@@ -0,0 +1,271 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/Verce11o/yata-auth/internal/domain"
+	"github.com/Verce11o/yata-auth/internal/lib/grpc_errors"
+	pb "github.com/Verce11o/yata-protos/gen/go/sso"
+	"github.com/google/uuid"
+	"time"
+)
+
+func (a *AuthService) ListSessions(ctx context.Context, accessToken string) ([]domain.Session, error) {
+	ctx, span := a.tracer.Start(ctx, "authService.ListSessions")
+	defer span.End()
+
+	claims, err := a.authenticate(ctx, accessToken)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := a.repo.GetUserSessions(ctx, claims.UserID)
+
+	if err != nil {
+		a.log.Errorf("cannot get user sessions: %v", err.Error())
+		return nil, err
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].SessionID.String() == claims.SessionID
+	}
+
+	return sessions, nil
+}
+
+func (a *AuthService) RevokeSession(ctx context.Context, accessToken string, input *pb.RevokeSessionRequest) error {
+	ctx, span := a.tracer.Start(ctx, "authService.RevokeSession")
+	defer span.End()
+
+	claims, err := a.authenticate(ctx, accessToken)
+
+	if err != nil {
+		return err
+	}
+
+	if err := a.repo.RevokeSession(ctx, claims.UserID, input.GetSessionId()); err != nil {
+		a.log.Errorf("cannot revoke session: %v", err.Error())
+		return err
+	}
+
+	if err := a.redis.RevokeSessionsCtx(ctx, a.jwtService.RefreshTokenTTL(), input.GetSessionId()); err != nil {
+		a.log.Errorf("cannot revoke session in redis: %v", err.Error())
+		return err
+	}
+
+	// revoking the current session logs the caller out
+	if input.GetSessionId() == claims.SessionID {
+		a.revokeAccessToken(ctx, claims)
+	}
+
+	return nil
+}
+
+func (a *AuthService) RevokeOtherSessions(ctx context.Context, accessToken string) error {
+	ctx, span := a.tracer.Start(ctx, "authService.RevokeOtherSessions")
+	defer span.End()
+
+	claims, err := a.authenticate(ctx, accessToken)
+
+	if err != nil {
+		return err
+	}
+
+	sessionIDs, err := a.repo.RevokeOtherSessions(ctx, claims.UserID, claims.SessionID)
+
+	if err != nil {
+		a.log.Errorf("cannot revoke other sessions: %v", err.Error())
+		return err
+	}
+
+	if err := a.redis.RevokeSessionsCtx(ctx, a.jwtService.RefreshTokenTTL(), sessionIDs...); err != nil {
+		a.log.Errorf("cannot revoke sessions in redis: %v", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// RevokeAllSessions logs the user out everywhere, including the current session.
+func (a *AuthService) RevokeAllSessions(ctx context.Context, accessToken string) error {
+	ctx, span := a.tracer.Start(ctx, "authService.RevokeAllSessions")
+	defer span.End()
+
+	claims, err := a.authenticate(ctx, accessToken)
+
+	if err != nil {
+		return err
+	}
+
+	if err := a.revokeAllTokens(ctx, claims.UserID); err != nil {
+		return err
+	}
+
+	a.revokeAccessToken(ctx, claims)
+
+	return nil
+}
+
+// revokeAllTokens bumps the token version of the user, which invalidates all
+// outstanding access tokens, and revokes their sessions and refresh tokens.
+func (a *AuthService) revokeAllTokens(ctx context.Context, userID string) error {
+	ctx, span := a.tracer.Start(ctx, "authService.revokeAllTokens")
+	defer span.End()
+
+	version, sessionIDs, err := a.repo.RevokeUserTokens(ctx, userID)
+
+	if err != nil {
+		a.log.Errorf("cannot revoke user tokens: %v", err.Error())
+		return err
+	}
+
+	a.tokensRevoked(ctx, userID, version, sessionIDs)
+
+	return nil
+}
+
+// tokensRevoked updates the caches after the token version of the user was bumped.
+func (a *AuthService) tokensRevoked(ctx context.Context, userID string, version int, sessionIDs []string) {
+	if err := a.redis.SetTokenVersionCtx(ctx, userID, version, a.jwtService.AccessTokenTTL()); err != nil {
+		a.log.Errorf("cannot set token version in redis: %v", err.Error())
+	}
+
+	if err := a.redis.RevokeSessionsCtx(ctx, a.jwtService.RefreshTokenTTL(), sessionIDs...); err != nil {
+		a.log.Errorf("cannot revoke sessions in redis: %v", err.Error())
+	}
+}
+
+// currentTokenVersion checks the token version in redis first and falls back to postgres.
+func (a *AuthService) currentTokenVersion(ctx context.Context, userID string) (int, error) {
+	version, ok, err := a.redis.GetTokenVersionCtx(ctx, userID)
+
+	if err != nil {
+		a.log.Errorf("cannot get token version in redis: %v", err.Error())
+	}
+
+	if ok {
+		return version, nil
+	}
+
+	version, err = a.repo.GetTokenVersion(ctx, userID)
+
+	if err != nil {
+		a.log.Errorf("cannot get token version in postgres: %v", err.Error())
+		return 0, err
+	}
+
+	if err := a.redis.SetTokenVersionCtx(ctx, userID, version, a.jwtService.AccessTokenTTL()); err != nil {
+		a.log.Errorf("cannot set token version in redis: %v", err.Error())
+	}
+
+	return version, nil
+}
+
+func (a *AuthService) createSession(ctx context.Context, userID uuid.UUID, client domain.ClientInfo) (*domain.Session, error) {
+	ctx, span := a.tracer.Start(ctx, "authService.createSession")
+	defer span.End()
+
+	session := &domain.Session{
+		SessionID:  uuid.New(),
+		UserID:     userID,
+		UserAgent:  client.UserAgent,
+		IP:         client.IP,
+		ExpireDate: time.Now().UTC().Add(a.jwtService.RefreshTokenTTL()),
+	}
+
+	newDevice := a.isNewDevice(ctx, userID, client)
+
+	if err := a.repo.CreateSession(ctx, session); err != nil {
+		return nil, err
+	}
+
+	if newDevice {
+		a.sendNewLoginEmail(ctx, userID, client)
+	}
+
+	if err := a.redis.SetSessionCtx(ctx, session); err != nil {
+		a.log.Errorf("cannot set session in redis: %v", err.Error())
+	}
+
+	return session, nil
+}
+
+// isNewDevice reports whether none of the active sessions of the user was
+// started from the same user agent and IP address.
+func (a *AuthService) isNewDevice(ctx context.Context, userID uuid.UUID, client domain.ClientInfo) bool {
+	sessions, err := a.repo.GetUserSessions(ctx, userID.String())
+
+	if err != nil {
+		a.log.Errorf("cannot get user sessions: %v", err.Error())
+		return false
+	}
+
+	for _, session := range sessions {
+		if session.UserAgent == client.UserAgent && session.IP == client.IP {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (a *AuthService) sendNewLoginEmail(ctx context.Context, userID uuid.UUID, client domain.ClientInfo) {
+	user, err := a.GetByUUID(ctx, userID.String())
+
+	if err != nil {
+		a.log.Errorf("cannot get user for new login email: %v", err.Error())
+		return
+	}
+
+	messageBytes, err := a.newEmailEvent(ctx, domain.EmailEventNewLogin, &user, client, map[string]string{
+		"user_agent": client.UserAgent,
+		"ip":         client.IP,
+	}, 0)
+
+	if err != nil {
+		a.log.Errorf("cannot build new login email: %v", err.Error())
+		return
+	}
+
+	if err := a.repo.AddOutboxMessage(ctx, messageBytes); err != nil {
+		a.log.Errorf("cannot send new login email: %v", err.Error())
+	}
+}
+
+// isSessionActive checks the session in redis first and falls back to postgres.
+func (a *AuthService) isSessionActive(ctx context.Context, sessionID string) (bool, error) {
+	ctx, span := a.tracer.Start(ctx, "authService.isSessionActive")
+	defer span.End()
+
+	cachedSession, err := a.redis.GetSessionCtx(ctx, sessionID)
+
+	if err != nil {
+		a.log.Errorf("cannot get session in redis: %v", err.Error())
+	}
+
+	if cachedSession != nil {
+		return cachedSession.IsActive(), nil
+	}
+
+	session, err := a.repo.GetSession(ctx, sessionID)
+
+	if errors.Is(err, grpc_errors.ErrNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		a.log.Errorf("cannot get session in postgres: %v", err.Error())
+		return false, err
+	}
+
+	if !session.IsActive() {
+		return false, nil
+	}
+
+	if err := a.redis.SetSessionCtx(ctx, session); err != nil {
+		a.log.Errorf("cannot set session in redis: %v", err.Error())
+	}
+
+	return true, nil
+}
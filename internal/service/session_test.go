@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/Verce11o/yata-auth/internal/domain"
+	"github.com/Verce11o/yata-auth/internal/lib/grpc_errors"
+	pb "github.com/Verce11o/yata-protos/gen/go/sso"
+	"github.com/google/uuid"
+	"testing"
+)
+
+// loginTwice signs the user in from two devices and returns the tokens of both sessions.
+func loginTwice(t *testing.T, a *AuthService) (domain.Tokens, domain.Tokens) {
+	t.Helper()
+
+	current := login(t, a, "user@example.com", "password123")
+
+	other, err := a.Login(context.Background(), &pb.LoginRequest{Email: "user@example.com", Password: "password123"}, domain.ClientInfo{UserAgent: "other", IP: "10.0.0.1"})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	return current, other
+}
+
+func sessionID(t *testing.T, a *AuthService, accessToken string) string {
+	t.Helper()
+
+	claims, err := a.jwtService.ParseToken(accessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return claims.SessionID
+}
+
+func isActive(t *testing.T, a *AuthService, accessToken string) bool {
+	t.Helper()
+
+	got, err := a.ValidateToken(context.Background(), &pb.ValidateTokenRequest{Token: accessToken})
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+
+	return got.Active
+}
+
+func TestListSessions(t *testing.T) {
+	a, repo, _ := newTestService(t)
+	addUser(t, a, repo, "user@example.com", "password123")
+
+	current, _ := loginTwice(t, a)
+
+	sessions, err := a.ListSessions(context.Background(), current.AccessToken)
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+
+	if len(sessions) != 2 {
+		t.Fatalf("ListSessions() returned %d sessions, want 2", len(sessions))
+	}
+
+	for _, session := range sessions {
+		want := session.SessionID.String() == sessionID(t, a, current.AccessToken)
+
+		if session.Current != want {
+			t.Errorf("session %v current = %v, want %v", session.SessionID, session.Current, want)
+		}
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	a, repo, _ := newTestService(t)
+	addUser(t, a, repo, "user@example.com", "password123")
+
+	current, other := loginTwice(t, a)
+
+	if err := a.RevokeSession(context.Background(), current.AccessToken, &pb.RevokeSessionRequest{SessionId: sessionID(t, a, other.AccessToken)}); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+
+	if isActive(t, a, other.AccessToken) {
+		t.Errorf("access token of the revoked session is still active")
+	}
+
+	if _, err := a.Refresh(context.Background(), &pb.RefreshRequest{RefreshToken: other.RefreshToken}); !errors.Is(err, grpc_errors.ErrInvalidRefreshToken) {
+		t.Errorf("Refresh() of the revoked session error = %v, want %v", err, grpc_errors.ErrInvalidRefreshToken)
+	}
+
+	if !isActive(t, a, current.AccessToken) {
+		t.Errorf("access token of the current session was revoked")
+	}
+
+	sessions, err := a.ListSessions(context.Background(), current.AccessToken)
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+
+	if len(sessions) != 1 {
+		t.Errorf("ListSessions() returned %d sessions, want 1", len(sessions))
+	}
+
+	tests := []struct {
+		name      string
+		sessionID string
+	}{
+		{name: "already revoked", sessionID: sessionID(t, a, other.AccessToken)},
+		{name: "unknown", sessionID: uuid.NewString()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := a.RevokeSession(context.Background(), current.AccessToken, &pb.RevokeSessionRequest{SessionId: tt.sessionID})
+
+			if !errors.Is(err, grpc_errors.ErrNotFound) {
+				t.Errorf("RevokeSession() error = %v, want %v", err, grpc_errors.ErrNotFound)
+			}
+		})
+	}
+}
+
+func TestRevokeCurrentSession(t *testing.T) {
+	a, repo, _ := newTestService(t)
+	addUser(t, a, repo, "user@example.com", "password123")
+
+	current := login(t, a, "user@example.com", "password123")
+
+	if err := a.RevokeSession(context.Background(), current.AccessToken, &pb.RevokeSessionRequest{SessionId: sessionID(t, a, current.AccessToken)}); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+
+	if isActive(t, a, current.AccessToken) {
+		t.Errorf("access token is still active after revoking its own session")
+	}
+}
+
+func TestRevokeOtherSessions(t *testing.T) {
+	a, repo, _ := newTestService(t)
+	addUser(t, a, repo, "user@example.com", "password123")
+
+	current, other := loginTwice(t, a)
+
+	if err := a.RevokeOtherSessions(context.Background(), current.AccessToken); err != nil {
+		t.Fatalf("RevokeOtherSessions: %v", err)
+	}
+
+	if isActive(t, a, other.AccessToken) {
+		t.Errorf("access token of the other session is still active")
+	}
+
+	if !isActive(t, a, current.AccessToken) {
+		t.Errorf("access token of the current session was revoked")
+	}
+
+	if _, err := a.Refresh(context.Background(), &pb.RefreshRequest{RefreshToken: current.RefreshToken}); err != nil {
+		t.Errorf("Refresh() of the current session: %v", err)
+	}
+}
+
+func TestRevokeAllSessions(t *testing.T) {
+	a, repo, _ := newTestService(t)
+	addUser(t, a, repo, "user@example.com", "password123")
+
+	current, other := loginTwice(t, a)
+
+	if err := a.RevokeAllSessions(context.Background(), current.AccessToken); err != nil {
+		t.Fatalf("RevokeAllSessions: %v", err)
+	}
+
+	for name, tokens := range map[string]domain.Tokens{"current": current, "other": other} {
+		if isActive(t, a, tokens.AccessToken) {
+			t.Errorf("access token of the %s session is still active", name)
+		}
+
+		if _, err := a.Refresh(context.Background(), &pb.RefreshRequest{RefreshToken: tokens.RefreshToken}); !errors.Is(err, grpc_errors.ErrInvalidRefreshToken) {
+			t.Errorf("Refresh() of the %s session error = %v, want %v", name, err, grpc_errors.ErrInvalidRefreshToken)
+		}
+	}
+
+	tokens := login(t, a, "user@example.com", "password123")
+
+	if !isActive(t, a, tokens.AccessToken) {
+		t.Errorf("access token issued after RevokeAllSessions is not active")
+	}
+}
+
+func TestTokenVersionInvalidation(t *testing.T) {
+	a, repo, redis := newTestService(t)
+	user := addUser(t, a, repo, "user@example.com", "password123")
+
+	tokens := login(t, a, "user@example.com", "password123")
+
+	if _, _, err := repo.RevokeUserTokens(context.Background(), user.UserID.String()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the cached version has not been bumped yet
+	if !isActive(t, a, tokens.AccessToken) {
+		t.Fatalf("access token is not active while the cached version is current")
+	}
+
+	delete(redis.tokenVersions, user.UserID.String())
+
+	if isActive(t, a, tokens.AccessToken) {
+		t.Errorf("access token of an older version is active after the cache expired")
+	}
+
+	if redis.tokenVersions[user.UserID.String()] != 1 {
+		t.Errorf("cached token version = %d, want 1", redis.tokenVersions[user.UserID.String()])
+	}
+
+	accessToken, err := a.jwtService.GenerateToken(uuid.NewString(), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if isActive(t, a, accessToken) {
+		t.Errorf("access token of an unknown user is active")
+	}
+}
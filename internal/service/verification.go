@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/Verce11o/yata-auth/config"
+	"github.com/Verce11o/yata-auth/internal/domain"
+	"github.com/Verce11o/yata-auth/internal/lib/grpc_errors"
+	"github.com/google/uuid"
+	"math/big"
+	"strings"
+	"time"
+)
+
+func (a *AuthService) codeConfig(codeType string) config.CodeConfig {
+	if codeType == PassCodeType {
+		return a.codes.Password
+	}
+
+	return a.codes.Email
+}
+
+// newVerificationCode creates a code in the format configured for its type
+// and returns the email variables delivering it. Only the digest of the code
+// is stored.
+func (a *AuthService) newVerificationCode(userID uuid.UUID, codeType string, endpoint string) (*domain.VerificationCode, map[string]string, time.Duration, error) {
+	cfg := a.codeConfig(codeType)
+
+	if cfg.Format == domain.CodeFormatOTP {
+		otp, err := generateOTP(cfg.OTPLength)
+
+		if err != nil {
+			return nil, nil, 0, err
+		}
+
+		ttl := time.Duration(cfg.OTPTTLMinutes) * time.Minute
+
+		return &domain.VerificationCode{
+			Type:       codeType,
+			CodeHash:   hashVerificationCode(otp),
+			Format:     domain.CodeFormatOTP,
+			UserID:     userID,
+			ExpireDate: time.Now().UTC().Add(ttl),
+		}, map[string]string{domain.EmailVariableCode: otp}, ttl, nil
+	}
+
+	code := uuid.NewString()
+	ttl := time.Duration(cfg.LinkTTLMinutes) * time.Minute
+
+	return &domain.VerificationCode{
+		Type:       codeType,
+		CodeHash:   hashVerificationCode(code),
+		Format:     domain.CodeFormatLink,
+		UserID:     userID,
+		ExpireDate: time.Now().UTC().Add(ttl),
+	}, map[string]string{domain.EmailVariableLink: fmt.Sprintf("%v?code=%v", endpoint, code)}, ttl, nil
+}
+
+// consumeVerificationCode consumes a link code, or the otp of the user when
+// userID is set. Every wrong otp counts, the code is invalidated once the
+// configured number of attempts is exhausted.
+func (a *AuthService) consumeVerificationCode(ctx context.Context, codeType string, userID string, input string) (*domain.VerificationCode, error) {
+	if userID == "" {
+		code, err := a.repo.ConsumeVerificationCode(ctx, codeType, hashVerificationCode(input))
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, grpc_errors.ErrCodeInvalid
+		}
+
+		if err != nil {
+			a.log.Errorf("cannot consume verification code in postgres: %v", err.Error())
+			return nil, grpc_errors.ErrGettingCode
+		}
+
+		return a.checkCodeExpiry(code)
+	}
+
+	code, err := a.repo.ConsumeUserVerificationCode(ctx, userID, codeType, hashVerificationCode(input))
+
+	if err == nil {
+		return a.checkCodeExpiry(code)
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		a.log.Errorf("cannot consume user verification code in postgres: %v", err.Error())
+		return nil, grpc_errors.ErrGettingCode
+	}
+
+	id, attempts, err := a.repo.IncrUserVerificationCodeAttempts(ctx, userID, codeType)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, grpc_errors.ErrCodeInvalid
+	}
+
+	if err != nil {
+		a.log.Errorf("cannot count verification code attempts: %v", err.Error())
+		return nil, grpc_errors.ErrGettingCode
+	}
+
+	if attempts >= a.codeConfig(codeType).MaxAttempts {
+		if err := a.repo.InvalidateVerificationCode(ctx, id); err != nil {
+			a.log.Errorf("cannot invalidate verification code: %v", err.Error())
+		}
+
+		return nil, grpc_errors.ErrTooManyAttempts
+	}
+
+	return nil, grpc_errors.ErrCodeInvalid
+}
+
+func (a *AuthService) checkCodeExpiry(code *domain.VerificationCode) (*domain.VerificationCode, error) {
+	if time.Now().UTC().After(code.ExpireDate) {
+		a.log.Errorf("code is expired")
+		return nil, grpc_errors.ErrCodeExpired
+	}
+
+	return code, nil
+}
+
+func hashVerificationCode(code string) string {
+	hash := sha256.Sum256([]byte(strings.TrimSpace(code)))
+
+	return hex.EncodeToString(hash[:])
+}
+
+// generateOTP returns a uniformly distributed numeric code of the given length.
+func generateOTP(length int) (string, error) {
+	limit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(length)), nil)
+
+	n, err := rand.Int(rand.Reader, limit)
+
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%0*d", length, n), nil
+}
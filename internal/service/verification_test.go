@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/Verce11o/yata-auth/internal/domain"
+	"github.com/Verce11o/yata-auth/internal/lib/grpc_errors"
+	pb "github.com/Verce11o/yata-protos/gen/go/sso"
+	"testing"
+	"time"
+)
+
+// addOTP stores a password reset otp of the user that expires after ttl.
+func addOTP(t *testing.T, repo *fakeRepo, user domain.User, otp string, ttl time.Duration) {
+	t.Helper()
+
+	err := repo.AddVerificationCode(context.Background(), &domain.VerificationCode{
+		Type:       PassCodeType,
+		CodeHash:   hashVerificationCode(otp),
+		Format:     domain.CodeFormatOTP,
+		UserID:     user.UserID,
+		ExpireDate: time.Now().UTC().Add(ttl),
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestForgotPasswordSendsOTP(t *testing.T) {
+	a, repo, _ := newTestService(t)
+	user := addUser(t, a, repo, "user@example.com", "password123")
+
+	if err := a.ForgotPassword(context.Background(), &pb.ForgotPasswordRequest{UserId: user.UserID.String()}, domain.ClientInfo{}); err != nil {
+		t.Fatalf("ForgotPassword: %v", err)
+	}
+
+	if len(repo.codes) != 1 || repo.codes[0].Format != domain.CodeFormatOTP {
+		t.Fatalf("ForgotPassword() stored %+v, want one otp", repo.codes)
+	}
+
+	if len(repo.outbox) != 1 {
+		t.Errorf("ForgotPassword() queued %d emails, want 1", len(repo.outbox))
+	}
+}
+
+func TestVerifyPasswordOTP(t *testing.T) {
+	a, repo, _ := newTestService(t)
+	user := addUser(t, a, repo, "user@example.com", "password123")
+
+	addOTP(t, repo, user, "123456", time.Minute)
+
+	if _, err := a.VerifyPassword(context.Background(), &pb.VerifyPasswordRequest{UserId: user.UserID.String(), Code: "000000"}); !errors.Is(err, grpc_errors.ErrCodeInvalid) {
+		t.Fatalf("VerifyPassword() with a wrong otp error = %v, want %v", err, grpc_errors.ErrCodeInvalid)
+	}
+
+	grant, err := a.VerifyPassword(context.Background(), &pb.VerifyPasswordRequest{UserId: user.UserID.String(), Code: " 123456 "})
+	if err != nil {
+		t.Fatalf("VerifyPassword: %v", err)
+	}
+
+	if grant == "" {
+		t.Fatal("VerifyPassword() returned no grant")
+	}
+
+	if _, err := a.VerifyPassword(context.Background(), &pb.VerifyPasswordRequest{UserId: user.UserID.String(), Code: "123456"}); !errors.Is(err, grpc_errors.ErrCodeInvalid) {
+		t.Errorf("VerifyPassword() with a consumed otp error = %v, want %v", err, grpc_errors.ErrCodeInvalid)
+	}
+}
+
+func TestVerifyPasswordOTPAttemptLimit(t *testing.T) {
+	a, repo, _ := newTestService(t)
+	user := addUser(t, a, repo, "user@example.com", "password123")
+
+	addOTP(t, repo, user, "123456", time.Minute)
+
+	maxAttempts := a.codes.Password.MaxAttempts
+
+	for i := 1; i <= maxAttempts; i++ {
+		want := grpc_errors.ErrCodeInvalid
+		if i == maxAttempts {
+			want = grpc_errors.ErrTooManyAttempts
+		}
+
+		_, err := a.VerifyPassword(context.Background(), &pb.VerifyPasswordRequest{UserId: user.UserID.String(), Code: "000000"})
+
+		if !errors.Is(err, want) {
+			t.Fatalf("attempt %d: VerifyPassword() error = %v, want %v", i, err, want)
+		}
+	}
+
+	if _, err := a.VerifyPassword(context.Background(), &pb.VerifyPasswordRequest{UserId: user.UserID.String(), Code: "123456"}); !errors.Is(err, grpc_errors.ErrCodeInvalid) {
+		t.Errorf("VerifyPassword() after the attempt limit error = %v, want %v", err, grpc_errors.ErrCodeInvalid)
+	}
+}
+
+func TestVerifyPasswordOTPExpired(t *testing.T) {
+	a, repo, _ := newTestService(t)
+	user := addUser(t, a, repo, "user@example.com", "password123")
+
+	addOTP(t, repo, user, "123456", -time.Minute)
+
+	if _, err := a.VerifyPassword(context.Background(), &pb.VerifyPasswordRequest{UserId: user.UserID.String(), Code: "123456"}); !errors.Is(err, grpc_errors.ErrCodeExpired) {
+		t.Errorf("VerifyPassword() with an expired otp error = %v, want %v", err, grpc_errors.ErrCodeExpired)
+	}
+}
+
+func TestGenerateOTP(t *testing.T) {
+	for _, length := range []int{4, 6, 8} {
+		otp, err := generateOTP(length)
+		if err != nil {
+			t.Fatalf("generateOTP(%d): %v", length, err)
+		}
+
+		if len(otp) != length {
+			t.Errorf("generateOTP(%d) = %q, want %d digits", length, otp, length)
+		}
+
+		for _, r := range otp {
+			if r < '0' || r > '9' {
+				t.Errorf("generateOTP(%d) = %q, want digits only", length, otp)
+				break
+			}
+		}
+	}
+}
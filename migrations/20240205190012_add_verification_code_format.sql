@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE verification_codes ALTER COLUMN code DROP DEFAULT;
+ALTER TABLE verification_codes ALTER COLUMN code TYPE varchar(64) USING code::text;
+ALTER TABLE verification_codes ALTER COLUMN code SET NOT NULL;
+ALTER TABLE verification_codes ADD COLUMN format varchar(16) NOT NULL DEFAULT 'link';
+ALTER TABLE verification_codes ADD COLUMN attempts INT NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_verification_codes_user_type ON verification_codes (user_id, type);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_verification_codes_user_type;
+DELETE FROM verification_codes WHERE format <> 'link';
+ALTER TABLE verification_codes DROP COLUMN attempts;
+ALTER TABLE verification_codes DROP COLUMN format;
+ALTER TABLE verification_codes ALTER COLUMN code TYPE UUID USING code::uuid;
+ALTER TABLE verification_codes ALTER COLUMN code SET DEFAULT uuid_generate_v4();
+-- +goose StatementEnd
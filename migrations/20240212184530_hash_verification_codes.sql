@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE verification_codes ADD COLUMN code_hash varchar(64);
+ALTER TABLE verification_codes ADD COLUMN used_at TIMESTAMP WITH TIME ZONE;
+
+-- codes were stored in plaintext, none of them can be trusted anymore
+UPDATE verification_codes SET used_at = CURRENT_TIMESTAMP WHERE used_at IS NULL;
+
+ALTER TABLE verification_codes DROP COLUMN code;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_verification_codes_link_hash ON verification_codes (code_hash) WHERE format = 'link' AND used_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_verification_codes_link_hash;
+DELETE FROM verification_codes;
+ALTER TABLE verification_codes ADD COLUMN code varchar(64) NOT NULL;
+ALTER TABLE verification_codes DROP COLUMN used_at;
+ALTER TABLE verification_codes DROP COLUMN code_hash;
+-- +goose StatementEnd
@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Emails that differ only in case have to be merged by hand before the index
+-- can be built, `email-duplicates` lists them.
+DO $$
+DECLARE
+    duplicates INT;
+BEGIN
+    SELECT count(*) INTO duplicates FROM (
+        SELECT lower(email) FROM users GROUP BY lower(email) HAVING count(*) > 1
+    ) AS d;
+
+    IF duplicates > 0 THEN
+        RAISE EXCEPTION '% email(s) are registered more than once with different case', duplicates
+            USING HINT = 'run email-duplicates, resolve every reported group, then rerun the migration';
+    END IF;
+END
+$$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower ON users (lower(email));
+
+-- Canonical form of the email with provider rules applied, used only to reject
+-- duplicate registrations of one mailbox. Existing rows are left NULL, run
+-- `email-duplicates -backfill` with the provider rules the service uses to
+-- fill them in.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_canonical VARCHAR(255);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_canonical ON users (email_canonical) WHERE email_canonical IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_users_email_canonical;
+
+ALTER TABLE users DROP COLUMN IF EXISTS email_canonical;
+
+DROP INDEX IF EXISTS idx_users_email_lower;
+-- +goose StatementEnd